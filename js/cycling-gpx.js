@@ -53,9 +53,50 @@
             attribution: '<a href="https://www.openstreetmap.org/copyright">© OpenStreetMap</a>'
         }
         L.tileLayer(url, options).addTo(map)
+        let overlays = {}
+        if (typeof heatmapTiles !== 'undefined') {
+            overlays['Теплокарта'] = L.tileLayer(heatmapTiles.url, {
+                minZoom: heatmapTiles.minZoom, maxNativeZoom: heatmapTiles.maxZoom, opacity: 0.8
+            })
+        }
+        // векторные тайлы показываются, если на странице подключен плагин Leaflet.VectorGrid
+        if (typeof vectorTiles !== 'undefined' && L.vectorGrid) {
+            const rides = L.vectorGrid.protobuf(vectorTiles.url, {
+                minZoom: vectorTiles.minZoom, maxNativeZoom: vectorTiles.maxZoom, interactive: true,
+                vectorTileLayerStyles: { rides: { color: TRACK_STYLE.color, weight: 2, opacity: 0.5 } }
+            })
+            rides.on('click', function (ev) {// выбор поездки щелчком по ее линии
+                $('select#tracks').val(ev.layer.properties.id).trigger('change')
+            })
+            overlays['Все поездки'] = rides
+        }
+        const hasExplorer = typeof explorerLayers !== 'undefined'
+        if (Object.keys(overlays).length > 0 || hasExplorer) {
+            const control = L.control.layers(null, overlays).addTo(map)
+            if (hasExplorer) {
+                addExplorerLayers(control)
+            }
+        }
         map.on("zoomend", onZoomEnd)
     }
 
+    function addExplorerLayers(control) {// слои исследованных тайлов загружаются в фоне
+        const styles = {
+            tiles: { color: '#0000ff', weight: 1, fillOpacity: 0.1 },
+            cluster: { color: '#0000ff', weight: 1, fillOpacity: 0.3 },
+            square: { color: '#ff0000', weight: 2, fill: false }
+        }
+        const names = { tiles: 'Тайлы', cluster: 'Кластер', square: 'Квадрат' }
+        for (const layers of explorerLayers) {
+            for (const kind of ['tiles', 'cluster', 'square']) {
+                fetch(layers[kind])
+                    .then(response => response.json())
+                    .then(data => control.addOverlay(L.geoJSON(data, { style: styles[kind] }), `${names[kind]} z${layers.zoom}`))
+                    .catch(err => console.log(`Не загружен слой ${layers[kind]}: ${err.message}`))
+            }
+        }
+    }
+
     function addTrack(track) {
         if (!!trackLayer) {
             trackLayer.remove()
@@ -87,6 +128,9 @@
     }
 
     function addVelocities(timestamp, zoom) {
+        if (!tracks[timestamp]) {
+            return // json-данные поездки еще загружаются
+        }
         if (!!velocityLayer) {
             if (velocityLayerTime == timestamp && velocityLayerZoom == zoom) {
                 return // этото слой скоростей уже построен - пропускаем
@@ -150,19 +194,64 @@
         return activeTime > 0 ? (3.6 * activeDist / activeTime) : 0
     }
 
-    function initSelector() {
-        let $select = $('select#tracks')
-        let $option, year, prevYear, yearDist = 0
+    /** поездки из json-данных, вписанных в страницу ссылками на каждую поездку */
+    function tracksRides() {
+        let rides = []
         for (const ts in tracks) {
             let track = tracks[ts]
-            let dist = trackDist(track) * 0.001
-            let speed = trackAverageSpeed(track)
-            let dt = new Date(Number(ts) * 1000)
+            // итоги поездки посчитаны gpx2js, в старых файлах их нет
+            rides.push({
+                ts: ts,
+                dist: track.st ? track.st.dist : trackDist(track),
+                speed: track.st ? track.st.avgSpeed : trackAverageSpeed(track),
+            })
+        }
+        return rides
+    }
+
+    /** поездки из манифеста, json-данные которых загружаются при выборе поездки */
+    function manifestRides(entries) {
+        let base = new URL(routesManifest, location.href)
+        return entries.map(e => ({
+            ts: e.id,
+            dist: e.distance,
+            speed: e.avgSpeed,
+            title: e.title,
+            file: new URL(e.file, base).href,
+        }))
+    }
+
+    /** загружает json-данные поездки, если их еще нет на странице */
+    function loadTrack(ride) {
+        return new Promise(function (resolve, reject) {
+            if (tracks[ride.ts] || !ride.file) {
+                resolve(tracks[ride.ts])
+                return
+            }
+            let script = document.createElement('script')
+            script.src = ride.file
+            script.onload = () => resolve(tracks[ride.ts])
+            script.onerror = () => reject(new Error(`не загружены json-данные поездки ${ride.file}`))
+            document.head.appendChild(script)
+        })
+    }
+
+    function initSelector(rides) {
+        let $select = $('select#tracks')
+        let $option, year, prevYear, yearDist = 0
+        let ridesByTs = {}
+        for (const ride of rides) {
+            ridesByTs[ride.ts] = ride
+            let dist = ride.dist * 0.001
+            let dt = new Date(Number(ride.ts) * 1000)
             year = dt.getFullYear()
             let caption = `${dt.datetime()}`
-                + `&nbsp;&nbsp;&nbsp;${speed.toFixed(2)}&thinsp;км/ч`
+                + `&nbsp;&nbsp;&nbsp;${ride.speed.toFixed(2)}&thinsp;км/ч`
                 + `&nbsp;&nbsp;&nbsp;${dist.toFixed(1)}&thinsp;км`
-            $option = $(`<option value='${ts}'>${caption}</option>`)
+            $option = $(`<option value='${ride.ts}'>${caption}</option>`)
+            if (ride.title) {
+                $option.attr('title', ride.title)
+            }
             $select.append($option)
             if (prevYear !== undefined && prevYear != year) {
                 let $prevOption = $option.prev()
@@ -181,11 +270,16 @@
         }
         $option.prop('selected', true)
         $select.change(function () {
-            trackTime = Number($(this).val())
-            let track = tracks[trackTime]
-            addTrack(track)
-            addVelocities(trackTime, map.getZoom())
-            location.hash = `#ts=${trackTime}`
+            let ts = Number($(this).val())
+            trackTime = ts
+            location.hash = `#ts=${ts}`
+            loadTrack(ridesByTs[ts]).then(function (track) {
+                if (trackTime != ts) {
+                    return // пока загружались данные, выбрана другая поездка
+                }
+                addTrack(track)
+                addVelocities(ts, map.getZoom())
+            }).catch(err => alert(err.message))
         })
         $select.trigger('change')
     }
@@ -195,5 +289,12 @@
     }
 
     initMap();
-    initSelector();
+    if (typeof routesManifest === 'undefined') {
+        initSelector(tracksRides())
+    } else {
+        fetch(routesManifest)
+            .then(response => response.json())
+            .then(entries => initSelector(manifestRides(entries)))
+            .catch(err => alert(`Не загружен манифест поездок ${routesManifest}: ${err.message}`))
+    }
 })()
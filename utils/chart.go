@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gpx2js/track"
+)
+
+// размеры графиков в пикселах
+const (
+	chartWidth  = 600
+	chartHeight = 200
+	chartLeft   = 48 // поле слева для подписей оси y
+	chartRight  = 10
+	chartTop    = 20 // поле сверху для названия оси y
+	chartBottom = 34 // поле снизу для подписей и названия оси x
+)
+
+// chart - график профиля поездки
+type chart struct {
+	class    string                      // css-класс svg: elevation, speed или hr
+	yTitle   string                      // название оси y с единицами измерения
+	xTitle   string                      // название оси x с единицами измерения
+	xs, ys   []float64                   // точки графика, NaN в ys - разрыв линии
+	xTicks   func(max float64) []float64 // отметки оси x от 0 до max
+	xLabel   func(x float64) string      // подпись отметки оси x
+	yPrec    int                         // знаков после запятой в подписях оси y
+	minSpan  float64                     // наименьший диапазон оси y
+	fill     bool                        // закрасить область под линией
+	avg      float64                     // уровень средней линии, 0 - без нее
+	avgLabel string                      // подпись средней линии
+}
+
+// formatNumber возвращает число с prec знаками после запятой, -1 - сколько нужно, по правилам русского языка:
+// с десятичной запятой и разделением разрядов неразрывным пробелом
+func formatNumber(x float64, prec int) string {
+	s := strconv.FormatFloat(x, 'f', prec, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "−", s[1:]
+	}
+	frac := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], ","+s[i+1:]
+	}
+	if len(s) > 4 { // четырехзначные числа по правилам не разделяются
+		var b strings.Builder
+		for i, c := range s {
+			if i > 0 && (len(s)-i)%3 == 0 {
+				b.WriteString(" ")
+			}
+			b.WriteRune(c)
+		}
+		s = b.String()
+	}
+	return sign + s + frac
+}
+
+// formatClock возвращает время в секундах в виде ч:мм
+func formatClock(sec float64) string {
+	m := int(math.Round(sec / 60))
+	return fmt.Sprintf("%d:%02d", m/60, m%60)
+}
+
+// niceStep возвращает шаг отметок 1, 2 или 5, умноженные на степень 10, при котором на
+// диапазоне span помещается не больше count отметок
+func niceStep(span float64, count int) float64 {
+	if span <= 0 {
+		return 1
+	}
+	raw := span / float64(count)
+	p := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*p >= raw {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// ticks возвращает отметки с шагом step от 0 до max
+func ticks(max float64, step float64) []float64 {
+	var res []float64
+	for i := 0; float64(i)*step <= max+step/1e6; i++ {
+		res = append(res, float64(i)*step)
+	}
+	return res
+}
+
+// distanceTicks возвращает отметки расстояния в метрах на круглых километрах
+func distanceTicks(max float64) []float64 {
+	return ticks(max, 1000*niceStep(max/1000, 6))
+}
+
+// timeTicks возвращает отметки времени в секундах на круглых минутах и часах
+func timeTicks(max float64) []float64 {
+	for _, m := range []float64{5, 10, 15, 30, 60, 120, 180, 360, 720} {
+		if max/(m*60) <= 8 {
+			return ticks(max, m*60)
+		}
+	}
+	return ticks(max, 1440*60)
+}
+
+// svg возвращает график в формате svg или пустую строку, если у графика меньше двух точек
+func (c *chart) svg() string {
+	minY, maxY, maxX := math.Inf(1), math.Inf(-1), 0.0
+	var n int
+	for i, y := range c.ys {
+		if math.IsNaN(y) {
+			continue
+		}
+		n++
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		maxX = math.Max(maxX, c.xs[i])
+	}
+	if n < 2 || maxX <= 0 {
+		return ""
+	}
+	if maxY-minY < c.minSpan { // на почти ровном графике колебания не растягиваются на всю высоту
+		mid := (minY + maxY) / 2
+		minY, maxY = mid-c.minSpan/2, mid+c.minSpan/2
+	}
+	if c.avg > 0 {
+		maxY = math.Max(maxY, c.avg)
+	}
+	step := niceStep(maxY-minY, 4)
+	minY, maxY = math.Floor(minY/step)*step, math.Ceil(maxY/step)*step
+	if minY == maxY {
+		maxY += step
+	}
+	w, h := float64(chartWidth-chartLeft-chartRight), float64(chartHeight-chartTop-chartBottom)
+	px := func(x float64) float64 { return chartLeft + x/maxX*w }
+	py := func(y float64) float64 { return chartTop + (maxY-y)/(maxY-minY)*h }
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="chart %s" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`,
+		c.class, chartWidth, chartHeight)
+	// сетка и подписи осей
+	b.WriteString(`<g stroke="#ddd" stroke-width="1">`)
+	ys := ticks(maxY-minY, step)
+	for _, y := range ys {
+		y += minY
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f"/>`, chartLeft, py(y), chartWidth-chartRight, py(y))
+	}
+	xs := c.xTicks(maxX)
+	for _, x := range xs {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.0f"/>`, px(x), chartTop, px(x), chartTop+h)
+	}
+	b.WriteString(`</g><g fill="#444">`)
+	for _, y := range ys {
+		y += minY
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`,
+			chartLeft-4, py(y), formatNumber(y, c.yPrec))
+	}
+	for _, x := range xs {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.0f" text-anchor="middle">%s</text>`, px(x), chartTop+h+14, c.xLabel(x))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="12">%s</text>`, chartLeft, c.yTitle)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text></g>`, chartWidth-chartRight, chartHeight-4, c.xTitle)
+	// линия графика, разрывы начинают новый участок
+	var path strings.Builder
+	start := -1 // первая точка текущего участка
+	for i, y := range c.ys {
+		if math.IsNaN(y) {
+			if start >= 0 && c.fill {
+				fmt.Fprintf(&path, "L%.1f %.1fL%.1f %.1fZ", px(c.xs[i-1]), chartTop+h, px(c.xs[start]), chartTop+h)
+			}
+			start = -1
+			continue
+		}
+		cmd := "L"
+		if start < 0 {
+			cmd, start = "M", i
+		}
+		fmt.Fprintf(&path, "%s%.1f %.1f", cmd, px(c.xs[i]), py(y))
+	}
+	if start >= 0 && c.fill {
+		fmt.Fprintf(&path, "L%.1f %.1fL%.1f %.1fZ", px(c.xs[len(c.xs)-1]), chartTop+h, px(c.xs[start]), chartTop+h)
+	}
+	if c.fill {
+		fmt.Fprintf(&b, `<path fill="#e600aa" fill-opacity="0.3" stroke="#e600aa" stroke-width="1.5" d="%s"/>`, path.String())
+	} else {
+		fmt.Fprintf(&b, `<path fill="none" stroke="#e600aa" stroke-width="1.5" stroke-linejoin="round" d="%s"/>`, path.String())
+	}
+	if c.avg > 0 {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#0000ff" stroke-dasharray="4 3"/>`,
+			chartLeft, py(c.avg), chartWidth-chartRight, py(c.avg))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" fill="#0000ff">%s</text>`,
+			chartWidth-chartRight-2, py(c.avg)-3, c.avgLabel)
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// elevationChart возвращает svg-график высоты от пройденного расстояния или пустую строку,
+// если высоты точек трека неизвестны
+func elevationChart(t *track.Track) string {
+	c := chart{class: "elevation", yTitle: "Высота, м", xTitle: "км", yPrec: 0, minSpan: 10, fill: true,
+		xTicks: distanceTicks, xLabel: func(x float64) string { return formatNumber(math.Round(x)/1000, -1) }}
+	var dist float64
+	for _, p := range t.Points() {
+		dist += p.Dist
+		c.xs = append(c.xs, dist)
+		if p.HasEle {
+			c.ys = append(c.ys, p.Ele)
+		} else {
+			c.ys = append(c.ys, math.NaN())
+		}
+	}
+	return c.svg()
+}
+
+// speedChart возвращает svg-график скорости движения от времени поездки со средней
+// скоростью. Остановки и отброшенные скорости, которые не учитываются в итогах поездки,
+// показаны разрывами линии
+func speedChart(t *track.Track) string {
+	s := t.Stats()
+	c := chart{class: "speed", yTitle: "Скорость, км/ч", xTitle: "ч:мм", yPrec: 0, minSpan: 10,
+		xTicks: timeTicks, xLabel: formatClock, avg: s.AvgSpeed,
+		avgLabel: "средняя " + formatNumber(s.AvgSpeed, 1) + " км/ч"}
+	for _, sp := range t.Speeds() {
+		c.xs = append(c.xs, sp.Elapsed)
+		if sp.Moving {
+			c.ys = append(c.ys, sp.Speed)
+		} else {
+			c.ys = append(c.ys, math.NaN())
+		}
+	}
+	return c.svg()
+}
+
+// heartRateChart возвращает svg-график пульса от времени поездки или пустую строку, если
+// в расширениях точек трека нет пульса
+func heartRateChart(t *track.Track) string {
+	c := chart{class: "hr", yTitle: "Пульс, уд/мин", xTitle: "ч:мм", yPrec: 0, minSpan: 20,
+		xTicks: timeTicks, xLabel: formatClock}
+	points := t.Points()
+	for _, p := range points {
+		c.xs = append(c.xs, p.Time.Sub(points[0].Time).Seconds())
+		if hr, ok := p.HeartRate(); ok {
+			c.ys = append(c.ys, float64(hr))
+		} else {
+			c.ys = append(c.ys, math.NaN())
+		}
+	}
+	return c.svg()
+}
+
+// rideCharts возвращает все графики профиля поездки, для которых в треке есть данные:
+// высоты, скорости и пульса
+func rideCharts(t *track.Track) []string {
+	var res []string
+	for _, f := range []func(*track.Track) string{elevationChart, speedChart, heartRateChart} {
+		if svg := f(t); svg != "" {
+			res = append(res, svg)
+		}
+	}
+	return res
+}
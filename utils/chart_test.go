@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"gpx2js/track"
+)
+
+func Example_formatNumber() {
+	for _, x := range []float64{0, 2.5, 1234.56, 17631, -1234567.8} {
+		fmt.Println(formatNumber(x, 1))
+	}
+	fmt.Println(formatNumber(0.5, -1), formatClock(5430))
+	// Output:
+	// 0,0
+	// 2,5
+	// 1234,6
+	// 17 631,0
+	// −1 234 567,8
+	// 0,5 1:31
+}
+
+func Test_niceStep(t *testing.T) {
+	for _, tc := range []struct {
+		span float64
+		want float64
+	}{{17.6, 5}, {40, 10}, {3, 1}, {0.9, 0.5}, {130, 50}} {
+		if got := niceStep(tc.span, 4); got != tc.want {
+			t.Errorf("niceStep(%v) = %v вместо %v", tc.span, got, tc.want)
+		}
+	}
+}
+
+func Test_rideCharts(t *testing.T) {
+	f, err := os.Open(".test/1622728859.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	trk, err := track.DecodeRoute(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	charts := rideCharts(trk)
+	if len(charts) != 1 || !strings.Contains(charts[0], `class="chart speed"`) {
+		t.Fatalf("без высот и пульса должен быть только график скорости: %d", len(charts))
+	}
+	avg := "средняя " + formatNumber(trk.Stats().AvgSpeed, 1) + " км/ч"
+	for _, want := range []string{avg, ">Скорость, км/ч<", ">0:40<"} {
+		if !strings.Contains(charts[0], want) {
+			t.Errorf("на графике скорости нет %s", want)
+		}
+	}
+	points := trk.Points()
+	for i := range points {
+		points[i].Ele, points[i].HasEle = float64(i%100), true
+		points[i].Ext = fmt.Sprintf("<gpxtpx:hr>%d</gpxtpx:hr>", 100+i%50)
+	}
+	charts = rideCharts(trk)
+	if len(charts) != 3 || !strings.Contains(charts[0], ">Высота, м<") || !strings.Contains(charts[2], ">Пульс, уд/мин<") {
+		t.Errorf("нет графиков высоты и пульса")
+	}
+	// пульс сохраняется в json-данных поездки, по которым строятся страницы поездок
+	var b bytes.Buffer
+	if err := trk.Encode(&b, track.JS); err != nil {
+		t.Fatal(err)
+	}
+	if trk, err = track.DecodeRoute(&b); err != nil {
+		t.Fatal(err)
+	}
+	if charts = rideCharts(trk); len(charts) != 3 || !strings.Contains(charts[2], ">Пульс, уд/мин<") {
+		t.Errorf("нет графика пульса по прочитанным json-данным: %d", len(charts))
+	}
+}
@@ -0,0 +1,931 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gpx2js/track"
+)
+
+// command - подкоманда утилиты
+type command struct {
+	name  string                    // имя подкоманды
+	title string                    // краткое описание для справки
+	run   func(args []string) error // разбор параметров и выполнение
+}
+
+// usageError - ошибка в параметрах подкоманды
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+var commands = []command{
+	{"convert", "конвертировать GPX-файлы в json-данные поездок", runConvert},
+	{"index", "вписать в html-файл ссылки на json-данные поездок", runIndex},
+	{"stats", "вывести сводку по поездкам из GPX-файлов", runStats},
+	{"validate", "проверить GPX-файлы", runValidate},
+	{"export", "вывести обработанный трек GPX-файла", runExport},
+	{"splits", "вывести разбивку поездки по километрам и кругам", runSplits},
+	{"chart", "записать svg-графики профиля поездки", runChart},
+	{"map", "нарисовать трек поездки на карте из локальных тайлов", runMap},
+	{"heatmap", "собрать теплокарту всех поездок", runHeatmap},
+	{"vector", "собрать векторные тайлы всех поездок", runVector},
+	{"explorer", "подсчитать исследованные поездками тайлы", runExplorer},
+	{"records", "вывести личные рекорды поездок и их историю", runRecords},
+	{"serve", "запустить http-сервер для просмотра сайта", runServe},
+	{"watch", "следить за появлением новых GPX-файлов", runWatch},
+	{"config", "проверить файл настроек (config check)", runConfig},
+}
+
+// findCommand возвращает подкоманду по имени
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// usage выводит общую справку по подкомандам
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Использование: %s <подкоманда> [флаги]\n\nПодкоманды:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.title)
+	}
+	fmt.Fprintf(w, "\nСправка по подкоманде: %s <подкоманда> -h\n", os.Args[0])
+	fmt.Fprintf(w, "Без подкоманды флаги -i, -o, -s выполняют convert и index.\n")
+}
+
+// newFlagSet создает набор флагов подкоманды со справкой
+func newFlagSet(name string, title string) *flag.FlagSet {
+	flags := flag.NewFlagSet(os.Args[0]+" "+name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Использование: %s %s [флаги]\n%s\n\nФлаги:\n", os.Args[0], name, title)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags разбирает флаги и проверяет их функцией check
+func parseFlags(flags *flag.FlagSet, args []string, check func() error) error {
+	err := flags.Parse(args)
+	if err == nil && check != nil {
+		err = check()
+	}
+	if err != nil {
+		if err != flag.ErrHelp {
+			flags.Usage()
+		}
+		return usageError{err}
+	}
+	return nil
+}
+
+// addConfigFlags добавляет флаг файла настроек и флаги, переопределяющие настройки профиля,
+// формата и точности чисел
+func addConfigFlags(flags *flag.FlagSet, cfg *config, withFormat bool) {
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	flags.StringVar(&cfg.Profile, "p", cfg.Profile, "Профиль фильтрации точек: cycling, walking, raw")
+	if withFormat {
+		flags.StringVar(&cfg.Format, "f", cfg.Format, "Форматы json-данных поездок через запятую: "+strings.Join(track.Formats, ", "))
+		flags.IntVar(&cfg.Precision.LL, "ll", cfg.Precision.LL, "Количество знаков после запятой в координатах, 0..10")
+		flags.IntVar(&cfg.Precision.DT, "dt", cfg.Precision.DT, "Количество знаков после запятой в интервалах времени, 0..3")
+		flags.IntVar(&cfg.Precision.DD, "dd", cfg.Precision.DD, "Количество знаков после запятой в расстояниях, 0..6")
+		flags.IntVar(&cfg.Precision.EL, "el", cfg.Precision.EL, "Количество знаков после запятой в высотах, 0..3")
+	}
+}
+
+// checkConfig проверяет настройки, используемые при чтении и записи треков
+func checkConfig(cfg *config) error {
+	if _, err := cfg.pipeline(); err != nil {
+		return err
+	}
+	if err := checkFormat(cfg.Format); err != nil {
+		return err
+	}
+	return cfg.checkPrecision()
+}
+
+// inputFiles возвращает список входных файлов по файловым маскам и каталогам настроек
+func (cfg *config) inputFiles() ([]string, error) {
+	if len(cfg.Input) < 1 {
+		return nil, errors.New("не указан входной файл")
+	}
+	return expandInputs(cfg.Input, cfg.Include, cfg.Exclude)
+}
+
+// globInput возвращает список файлов по файловой маске
+func globInput(input string) ([]string, error) {
+	cfg := newConfig()
+	if input != "" {
+		cfg.Input = []string{input}
+	}
+	return cfg.inputFiles()
+}
+
+// inputFlags добавляет повторяемые флаги -i, -include и -exclude, заменяющие
+// соответствующие настройки при первом указании и дополняющие их при последующих
+func inputFlags(flags *flag.FlagSet, cfg *config) {
+	listFlag(flags, "i", &cfg.Input, "Входной GPX-файл, файловая маска (допускается **) или каталог; можно повторять")
+	listFlag(flags, "include", &cfg.Include, "Маска файлов, отбираемых в каталогах; можно повторять")
+	listFlag(flags, "exclude", &cfg.Exclude, "Маска пропускаемых файлов и каталогов; можно повторять")
+}
+
+// listFlag добавляет повторяемый флаг, значения которого заменяют список list
+func listFlag(flags *flag.FlagSet, name string, list *[]string, usage string) {
+	var set bool
+	flags.Func(name, usage, func(value string) error {
+		if !set {
+			*list = nil
+			set = true
+		}
+		*list = append(*list, value)
+		return nil
+	})
+}
+
+// htmlFlag добавляет флаг -s, заменяющий html-файлы настроек
+func htmlFlag(flags *flag.FlagSet, cfg *config, usage string) {
+	flags.Func("s", usage, func(html string) error {
+		cfg.HTML = []string{html}
+		return nil
+	})
+}
+
+func runConvert(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("convert", "Конвертирует GPX-файлы в json-данные поездок. Html-файлы и страницы сайта по "+
+		"json-данным пересобирает подкоманда index")
+	var files []string
+	var dryRun, verbose bool
+	addConfigFlags(flags, cfg, true)
+	inputFlags(flags, cfg)
+	flags.StringVar(&cfg.Output, "o", cfg.Output, "Каталог, куда будут сохранены json-данные поездок")
+	flags.BoolVar(&verbose, "v", false, "Выводить отчеты этапов обработки точек")
+	flags.BoolVar(&dryRun, "dry-run", false, "Только показать, какие файлы json-данных и блоки ссылок html-файлов изменятся, ничего не записывая")
+	err = parseFlags(flags, args, func() (err error) {
+		if files, err = cfg.inputFiles(); err == nil {
+			if err = checkDir(cfg.Output, "выходной"); err == nil {
+				err = checkConfig(cfg)
+			}
+		}
+		return
+	})
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return printPlan(os.Stdout, files, cfg)
+	}
+	return convertFiles(files, cfg, verbose)
+}
+
+// convertFiles конвертирует GPX-файлы в json-данные поездок в выходной каталог настроек
+func convertFiles(files []string, cfg *config, verbose bool) error {
+	var sizes sizeReport
+	for _, file := range files {
+		fmt.Print(file)
+		c, err := prepareConversion(file, cfg)
+		if err == nil {
+			err = c.write()
+		}
+		if err != nil {
+			fmt.Println()
+			return err
+		}
+		fmt.Print(" ->")
+		for i, out := range c.outputs {
+			if i > 0 {
+				fmt.Print(",")
+			}
+			fmt.Print(" " + out.path)
+			if out.action == actionSkip {
+				fmt.Print(" (" + actionSkip + ")")
+			}
+		}
+		fmt.Println()
+		for _, file := range c.removed {
+			fmt.Printf("\t%s: %s\n", file, actionRemove)
+		}
+		fmt.Printf("\t%s\n", sizes.add(c))
+		if verbose {
+			c.printReports(os.Stdout)
+		}
+	}
+	if len(files) > 1 {
+		fmt.Printf("итого файлов %d: %s\n", sizes.files, sizes)
+	}
+	return nil
+}
+
+// updateHtmls записывает манифест json-данных поездок, если он задан в настройках,
+// вписывает во все html-файлы настроек ссылку на манифест или ссылки на json-данные поездок
+// и собирает страницы по шаблонам
+func updateHtmls(cfg *config) error {
+	if !cfg.needsRides() {
+		for _, html := range cfg.HTML {
+			if err := updateHtml(html, cfg.Output); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	rides, err := loadRides(cfg.Output)
+	if err != nil {
+		return err
+	}
+	if cfg.Thumbnails != nil {
+		if err = writeThumbnails(cfg.Thumbnails, rides); err != nil {
+			return err
+		}
+	}
+	if cfg.Map != nil {
+		if err = writeMaps(cfg.Map, rides, cfg.path); err != nil {
+			return err
+		}
+	}
+	if cfg.Heatmap != nil {
+		report, err := updateHeatmap(cfg.Heatmap, rides, false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", cfg.Heatmap.Output, report)
+	}
+	if cfg.Vector != nil {
+		count, err := writeVectorTiles(cfg.Vector, rides)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			fmt.Printf("%s: записано векторных тайлов %d\n", cfg.Vector.Output, count)
+		}
+	}
+	if cfg.Explorer != nil {
+		stats, err := writeExplorer(cfg.Explorer, rides)
+		if err != nil {
+			return err
+		}
+		for _, zs := range stats {
+			fmt.Printf("%s: %s\n", cfg.Explorer.Output, zs)
+		}
+	}
+	if cfg.Records != nil {
+		store, fresh, err := updateRecords(cfg.Records, rides)
+		if err != nil {
+			return err
+		}
+		for _, line := range newRecords(store, fresh) {
+			fmt.Printf("%s: %s\n", cfg.Records.Output, line)
+		}
+	}
+	if cfg.Manifest != "" {
+		if err = writeManifest(rides, cfg.Manifest); err != nil {
+			return err
+		}
+	}
+	if err = writePages(cfg, rides); err != nil {
+		return err
+	}
+	if cfg.Manifest == "" {
+		for _, html := range cfg.HTML {
+			if err = updateHtml(html, cfg.Output); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, html := range cfg.HTML {
+		prevLines, postLines, err := readHtml(html)
+		if err != nil {
+			return err
+		}
+		lines, err := htmlBlockLines(cfg, html, nil)
+		if err != nil {
+			return err
+		}
+		if err = writeHtmlLines(html, prevLines, lines, postLines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manifestFlag добавляет флаг -manifest, задающий путь манифеста json-данных поездок
+func manifestFlag(flags *flag.FlagSet, cfg *config) {
+	flags.StringVar(&cfg.Manifest, "manifest", cfg.Manifest,
+		"Путь манифеста json-данных поездок, тогда в html-файлы вписывается только ссылка на него")
+}
+
+func runIndex(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("index", "Вписывает в html-файлы ссылки на все json-данные поездок каталога или записывает их манифест")
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	flags.StringVar(&cfg.Output, "o", cfg.Output, "Каталог json-данных поездок")
+	htmlFlag(flags, cfg, "Путь html-файла, в который надо вписать ссылки на json-данные поездок")
+	manifestFlag(flags, cfg)
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "Только показать, что изменится в html-файлах и сайте, ничего не записывая")
+	err = parseFlags(flags, args, func() error {
+		if len(cfg.HTML) < 1 && !cfg.needsRides() {
+			return errors.New("не указан html-файл")
+		}
+		return checkDir(cfg.Output, "выходной")
+	})
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return printIndexPlan(os.Stdout, cfg)
+	}
+	return updateHtmls(cfg)
+}
+
+// parseInputArgs разбирает флаги подкоманды, читающей входные GPX-файлы. Свои флаги
+// подкоманды добавляет addFlags, если она задана
+func parseInputArgs(name string, title string, args []string, addFlags func(*flag.FlagSet)) (*config, []string, error) {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	flags := newFlagSet(name, title)
+	var files []string
+	addConfigFlags(flags, cfg, false)
+	inputFlags(flags, cfg)
+	if addFlags != nil {
+		addFlags(flags)
+	}
+	err = parseFlags(flags, args, func() (err error) {
+		if files, err = cfg.inputFiles(); err == nil {
+			err = checkConfig(cfg)
+		}
+		return
+	})
+	return cfg, files, err
+}
+
+func runStats(args []string) error {
+	var asJSON bool
+	cfg, files, err := parseInputArgs("stats", "Выводит итоги поездок: дату, время в пути и в движении, расстояние, "+
+		"среднюю и максимальную скорость, набор и сброс высоты", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&asJSON, "json", false, "Выводить итоги в формате json, по объекту на строку")
+	})
+	if err != nil {
+		return err
+	}
+	p, _ := cfg.pipeline()
+	enc := json.NewEncoder(os.Stdout)
+	for _, file := range files {
+		t, _, err := decodeFile(file, p)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		if asJSON {
+			err = enc.Encode(struct {
+				File  string    `json:"file"`
+				ID    string    `json:"id"`
+				Start time.Time `json:"startTime"`
+				track.Stats
+			}{file, t.Key(), t.Start(), t.Stats()})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%s\t%s\n", file, statsSummary(t))
+	}
+	return nil
+}
+
+// statsSummary возвращает строку с датой, временем в пути и в движении, расстоянием,
+// средней и максимальной скоростью, если известны высоты, набором и сбросом высоты трека и,
+// если начало или конец трека скрыты, скрытыми метрами
+func statsSummary(t *track.Track) string {
+	if t.Len() < 1 {
+		return "нет данных"
+	}
+	s := t.Stats()
+	sec := func(v float64) time.Duration { return time.Duration(v) * time.Second }
+	summary := fmt.Sprintf("%s\t%s\t%s\t%.1f км\t%.2f км/ч\t%.1f км/ч",
+		t.Start().Local().Format("2006-01-02 15:04"), sec(s.Elapsed), sec(s.Moving), s.Dist*0.001, s.AvgSpeed, s.MaxSpeed)
+	if s.HasEle {
+		summary += fmt.Sprintf("\t+%.0f/-%.0f м", s.Gain, s.Loss)
+	}
+	if s.HiddenStart > 0 || s.HiddenEnd > 0 {
+		summary += fmt.Sprintf("\tскрыто %.0f/%.0f м", s.HiddenStart, s.HiddenEnd)
+	}
+	return summary
+}
+
+func runValidate(args []string) error {
+	cfg, files, err := parseInputArgs("validate", "Проверяет, что GPX-файлы читаются и содержат точки трека", args, nil)
+	if err != nil {
+		return err
+	}
+	p, _ := cfg.pipeline()
+	var invalid int
+	for _, file := range files {
+		t, _, err := decodeFile(file, p)
+		if err == nil && t.Len() < 1 {
+			err = track.ErrEmpty
+		}
+		if err != nil {
+			invalid++
+			fmt.Printf("%s: Ошибка: %s\n", file, err.Error())
+		} else {
+			fmt.Printf("%s: %d точек\n", file, t.Len())
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("неверных файлов: %d из %d", invalid, len(files))
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("export", "Выводит обработанный трек GPX-файла или json-данных поездки в заданном формате")
+	var input, output string
+	var share bool
+	var opts track.ShareOptions
+	addConfigFlags(flags, cfg, true)
+	flags.StringVar(&input, "i", "", "Имя входного GPX-файла или файла json-данных поездки")
+	flags.StringVar(&output, "o", "", "Имя выходного файла, по умолчанию трек выводится на экран")
+	flags.BoolVar(&share, "share", false, "Обезличить трек для публикации в формате gpx или geojson: "+
+		"время от начала поездки, без названия и данных датчиков")
+	flags.Float64Var(&opts.Jitter, "jitter", 0, "Наибольший случайный сдвиг обезличенного трека в метрах, общий для всех точек")
+	flags.IntVar(&opts.Digits, "digits", 0, "Количество знаков после запятой, до которого отбрасываются координаты обезличенного трека")
+	err = parseFlags(flags, args, func() error {
+		if input == "" {
+			return errors.New("не указан входной файл")
+		}
+		if err := checkConfig(cfg); err != nil {
+			return err
+		}
+		f, err := cfg.format()
+		if err != nil {
+			return err
+		}
+		if !share && (opts.Jitter != 0 || opts.Digits != 0) {
+			return errors.New("флаги -jitter и -digits используются только с флагом -share")
+		}
+		if share && f.Name != track.GPX.Name && f.Name != track.GeoJSON.Name {
+			return fmt.Errorf("обезличенный трек записывается только в форматах gpx и geojson вместо '%s'", f.Name)
+		}
+		if opts.Jitter < 0 || opts.Jitter > 1000 {
+			return fmt.Errorf("сдвиг трека %g м вне диапазона 0..1000", opts.Jitter)
+		}
+		if opts.Digits < 0 || opts.Digits > 10 {
+			return fmt.Errorf("количество знаков координат %d вне диапазона 0..10", opts.Digits)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p, _ := cfg.pipeline()
+	f, _ := cfg.format()
+	t, _, err := decodeFile(input, p)
+	if err != nil {
+		return err
+	}
+	if share {
+		t = t.Share(opts)
+	}
+	var buf bytes.Buffer
+	if err = t.Encode(&buf, f); err != nil {
+		return err
+	}
+	if output != "" {
+		return writeFileAtomic(output, buf.Bytes(), 0644)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+func runSplits(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("splits", "Выводит таблицу отрезков поездки из GPX-, TCX- или FIT-файла: по расстоянию или по кругам")
+	var input string
+	var laps bool
+	step := cfg.Splits
+	if step == 0 {
+		step = 1000
+	}
+	addConfigFlags(flags, cfg, false)
+	flags.StringVar(&input, "i", "", "Имя входного GPX-, TCX- или FIT-файла или файла json-данных поездки")
+	flags.Float64Var(&step, "d", step, "Длина отрезков в метрах")
+	flags.BoolVar(&laps, "laps", false, "Разбить поездку по кругам вместо расстояния")
+	err = parseFlags(flags, args, func() error {
+		if input == "" {
+			return errors.New("не указан входной файл")
+		}
+		if step <= 0 {
+			return fmt.Errorf("длина отрезков %g м не больше нуля", step)
+		}
+		return checkConfig(cfg)
+	})
+	if err != nil {
+		return err
+	}
+	p, _ := cfg.pipeline()
+	t, _, err := decodeFile(input, p)
+	if err != nil {
+		return err
+	}
+	splits := t.Splits(step)
+	if laps {
+		if splits = t.LapSplits(); splits == nil {
+			return errors.New("в треке нет кругов")
+		}
+	}
+	printSplits(os.Stdout, splits)
+	return nil
+}
+
+// printSplits выводит таблицу отрезков разбивки поездки: номер, расстояние от начала
+// поездки в конце отрезка, длину, продолжительность, среднюю скорость, изменение высоты и
+// средний пульс, если они известны
+func printSplits(w io.Writer, splits []track.Split) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "№\tкм\tдлина, м\tвремя\tкм/ч\tвысота, м\tпульс\t")
+	var dist float64
+	for i, s := range splits {
+		dist += s.Dist
+		ele, hr := "-", "-"
+		if s.HasEle {
+			ele = fmt.Sprintf("%+.0f", s.Ele)
+		}
+		if s.HR > 0 {
+			hr = fmt.Sprintf("%.0f", s.HR)
+		}
+		fmt.Fprintf(tw, "%d\t%.2f\t%.0f\t%s\t%.1f\t%s\t%s\t\n",
+			i+1, dist/1000, s.Dist, time.Duration(math.Round(s.Time))*time.Second, s.Speed, ele, hr)
+	}
+	tw.Flush()
+}
+
+func runServe(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("serve", "Запускает http-сервер, раздающий файлы сайта")
+	var dir, addr string
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	flags.StringVar(&dir, "d", filepath.Dir(cfg.path), "Корневой каталог сайта, по умолчанию каталог файла настроек")
+	flags.StringVar(&addr, "a", "localhost:8080", "Адрес и порт http-сервера")
+	if err := parseFlags(flags, args, func() error { return checkDir(dir, "корневой") }); err != nil {
+		return err
+	}
+	fmt.Printf("Сайт из каталога '%s' доступен по адресу http://%s/\n", dir, addr)
+	return http.ListenAndServe(addr, http.FileServer(http.Dir(dir)))
+}
+
+func runWatch(args []string) error {
+	w, err := parseWatchArgs(args)
+	if err != nil {
+		return err
+	}
+	return w.run()
+}
+
+func runChart(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("chart", "Записывает svg-графики высоты, скорости и пульса поездки по обработанным точкам трека")
+	var input, output string
+	addConfigFlags(flags, cfg, false)
+	flags.StringVar(&input, "i", "", "Имя входного GPX-файла или файла json-данных поездки")
+	flags.StringVar(&output, "o", ".", "Каталог графиков <ключ поездки>-<график>.svg")
+	err = parseFlags(flags, args, func() error {
+		if input == "" {
+			return errors.New("не указан входной файл")
+		}
+		if err := checkDir(output, "выходной"); err != nil {
+			return err
+		}
+		return checkConfig(cfg)
+	})
+	if err != nil {
+		return err
+	}
+	p, _ := cfg.pipeline()
+	t, _, err := decodeFile(input, p)
+	if err != nil {
+		return err
+	}
+	if t.Len() < 1 {
+		return track.ErrEmpty
+	}
+	for _, c := range []struct {
+		name string
+		svg  string
+	}{
+		{"elevation", elevationChart(t)},
+		{"speed", speedChart(t)},
+		{"hr", heartRateChart(t)},
+	} {
+		if c.svg == "" {
+			fmt.Printf("%s: нет данных\n", c.name)
+			continue
+		}
+		file := filepath.Join(output, t.Key()+"-"+c.name+".svg")
+		if err = writeFileAtomic(file, []byte(c.svg+"\n"), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", c.name, file)
+	}
+	return nil
+}
+
+func runMap(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	spec := mapSpec{}
+	if cfg.Map != nil {
+		spec = *cfg.Map
+	}
+	spec.setDefaults()
+	flags := newFlagSet("map", "Записывает PNG-картинку трека поездки на тайлах карты из локального каталога без доступа к сети")
+	var input, output string
+	addConfigFlags(flags, cfg, false)
+	flags.StringVar(&input, "i", "", "Имя входного GPX-файла или файла json-данных поездки")
+	flags.StringVar(&output, "o", "", "Имя выходного PNG-файла, по умолчанию <ключ поездки>.png в текущем каталоге")
+	flags.StringVar(&spec.Tiles, "tiles", spec.Tiles, "Каталог тайлов {z}/{x}/{y}.png или шаблон пути тайла с {z}, {x} и {y}; файлы MBTiles не читаются, "+
+		"их нужно выгрузить в каталог, например, утилитой mb-util")
+	flags.IntVar(&spec.Width, "width", spec.Width, "Ширина карты в пикселах")
+	flags.IntVar(&spec.Height, "height", spec.Height, "Высота карты в пикселах")
+	flags.IntVar(&spec.MaxZoom, "z", spec.MaxZoom, "Наибольший масштаб тайлов")
+	err = parseFlags(flags, args, func() error {
+		if input == "" {
+			return errors.New("не указан входной файл")
+		}
+		spec.Output = "."
+		if err := spec.check(); err != nil {
+			return err
+		}
+		return checkConfig(cfg)
+	})
+	if err != nil {
+		return err
+	}
+	p, _ := cfg.pipeline()
+	t, _, err := decodeFile(input, p)
+	if err != nil {
+		return err
+	}
+	if t.Len() < 1 {
+		return track.ErrEmpty
+	}
+	data, missing, err := renderMap(t, &spec, newTiles(spec.Tiles))
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = t.Key() + ".png"
+	}
+	if missing > 0 {
+		fmt.Printf("нет тайлов карты: %d\n", missing)
+	}
+	fmt.Println(output)
+	return writeFileAtomic(output, data, 0644)
+}
+
+func runHeatmap(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	spec := heatmapSpec{Output: "heatmap"}
+	if cfg.Heatmap != nil {
+		spec = *cfg.Heatmap
+	}
+	spec.setDefaults()
+	flags := newFlagSet("heatmap", "Добавляет в теплокарту - пирамиду PNG-тайлов {z}/{x}/{y}.png - новые поездки каталога json-данных")
+	var full bool
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	flags.StringVar(&cfg.Output, "routes", cfg.Output, "Каталог json-данных поездок")
+	flags.StringVar(&spec.Output, "o", spec.Output, "Каталог тайлов теплокарты")
+	flags.StringVar(&spec.State, "state", spec.State, "Каталог счетчиков тайлов и состояния теплокарты, по умолчанию скрытый каталог рядом с каталогом тайлов")
+	flags.IntVar(&spec.MinZoom, "minz", spec.MinZoom, "Наименьший масштаб тайлов")
+	flags.IntVar(&spec.MaxZoom, "maxz", spec.MaxZoom, "Наибольший масштаб тайлов")
+	flags.IntVar(&spec.Saturation, "saturation", spec.Saturation, "Количество поездок, при котором цвет пиксела самый яркий")
+	flags.BoolVar(&full, "full", false, "Собрать теплокарту заново из всех поездок")
+	err = parseFlags(flags, args, func() error {
+		if err := checkDir(cfg.Output, "входной"); err != nil {
+			return err
+		}
+		return spec.check()
+	})
+	if err != nil {
+		return err
+	}
+	rides, err := loadRides(cfg.Output)
+	if err != nil {
+		return err
+	}
+	report, err := updateHeatmap(&spec, rides, full)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s\n", spec.Output, report)
+	return nil
+}
+
+func runVector(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	spec := vectorSpec{Output: "vector"}
+	if cfg.Vector != nil {
+		spec = *cfg.Vector
+	}
+	spec.setDefaults()
+	flags := newFlagSet("vector", "Собирает векторные тайлы Mapbox Vector Tile {z}/{x}/{y}.pbf со всеми поездками каталога json-данных")
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	flags.StringVar(&cfg.Output, "routes", cfg.Output, "Каталог json-данных поездок")
+	flags.StringVar(&spec.Output, "o", spec.Output, "Каталог векторных тайлов")
+	flags.IntVar(&spec.MinZoom, "minz", spec.MinZoom, "Наименьший масштаб тайлов")
+	flags.IntVar(&spec.MaxZoom, "maxz", spec.MaxZoom, "Наибольший масштаб тайлов")
+	err = parseFlags(flags, args, func() error {
+		if err := checkDir(cfg.Output, "входной"); err != nil {
+			return err
+		}
+		return spec.check()
+	})
+	if err != nil {
+		return err
+	}
+	rides, err := loadRides(cfg.Output)
+	if err != nil {
+		return err
+	}
+	count, err := writeVectorTiles(&spec, rides)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: записано векторных тайлов %d\n", spec.Output, count)
+	return nil
+}
+
+func runExplorer(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	spec := explorerSpec{Output: "explorer"}
+	if cfg.Explorer != nil {
+		spec = *cfg.Explorer
+	}
+	spec.setDefaults()
+	zooms := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(spec.Zooms)), ","), "[]")
+	flags := newFlagSet("explorer", "Подсчитывает тайлы OSM, через которые прошли поездки каталога json-данных, "+
+		"наибольший квадрат и кластер тайлов и новые тайлы каждой поездки")
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	flags.StringVar(&cfg.Output, "routes", cfg.Output, "Каталог json-данных поездок")
+	flags.StringVar(&spec.Output, "o", spec.Output, "Каталог итогов и слоев GeoJSON")
+	flags.StringVar(&zooms, "z", zooms, "Масштабы тайлов через запятую")
+	err = parseFlags(flags, args, func() error {
+		if err := checkDir(cfg.Output, "входной"); err != nil {
+			return err
+		}
+		var err error
+		if spec.Zooms, err = parseZooms(zooms); err != nil {
+			return err
+		}
+		return spec.check()
+	})
+	if err != nil {
+		return err
+	}
+	rides, err := loadRides(cfg.Output)
+	if err != nil {
+		return err
+	}
+	stats, err := writeExplorer(&spec, rides)
+	if err != nil {
+		return err
+	}
+	news := make(map[string][]string) // новые тайлы поездок по масштабам
+	for _, zs := range stats {
+		for _, er := range zs.Rides {
+			if er.New > 0 {
+				news[er.ID] = append(news[er.ID], fmt.Sprintf("z%d +%d", zs.Zoom, er.New))
+			}
+		}
+	}
+	for _, r := range rides {
+		if len(news[r.ID]) > 0 {
+			fmt.Printf("%s: новые тайлы %s\n", r.Name(), strings.Join(news[r.ID], ", "))
+		}
+	}
+	for _, zs := range stats {
+		fmt.Println(zs)
+	}
+	return nil
+}
+
+func runRecords(args []string) error {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	spec := recordsSpec{Output: "records.json"}
+	if cfg.Records != nil {
+		spec = *cfg.Records
+	}
+	spec.setDefaults()
+	numbers := func(xs []float64) string {
+		return strings.Trim(strings.Join(strings.Fields(fmt.Sprint(xs)), ","), "[]")
+	}
+	dists, times := numbers(spec.Dists), numbers(spec.Times)
+	var input string
+	flags := newFlagSet("records", "Обновляет хранилище личных рекордов по поездкам каталога json-данных и выводит "+
+		"историю рекордов: какая поездка установила каждый рекорд и когда он был побит. С флагом -r выводит лучшие "+
+		"результаты одной поездки")
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	flags.StringVar(&cfg.Output, "routes", cfg.Output, "Каталог json-данных поездок")
+	flags.StringVar(&spec.Output, "o", spec.Output, "Файл хранилища рекордов")
+	flags.StringVar(&input, "r", "", "GPX-, TCX-, FIT-файл или файл json-данных одной поездки")
+	flags.StringVar(&dists, "d", dists, "Дистанции в километрах через запятую")
+	flags.StringVar(&times, "t", times, "Продолжительности в минутах через запятую")
+	err = parseFlags(flags, args, func() error {
+		var err error
+		if spec.Dists, err = parseNumbers(dists); err != nil {
+			return err
+		}
+		if spec.Times, err = parseNumbers(times); err != nil {
+			return err
+		}
+		if input != "" {
+			return checkConfig(cfg)
+		}
+		if err = checkDir(cfg.Output, "входной"); err != nil {
+			return err
+		}
+		return spec.check()
+	})
+	if err != nil {
+		return err
+	}
+	if input != "" {
+		p, _ := cfg.pipeline()
+		t, _, err := decodeFile(input, p)
+		if err != nil {
+			return err
+		}
+		printEfforts(os.Stdout, t, spec.defs())
+		return nil
+	}
+	rides, err := loadRides(cfg.Output)
+	if err != nil {
+		return err
+	}
+	store, _, err := updateRecords(&spec, rides)
+	if err != nil {
+		return err
+	}
+	printRecords(os.Stdout, store)
+	return nil
+}
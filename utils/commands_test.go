@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+func Example_runValidate() {
+	err := runValidate([]string{"-i=.test/*_июня_*.gpx"})
+	fmt.Println(err)
+	// Output:
+	// .test/2_июня_2021 г.,_15_19.gpx: 1244 точек
+	// .test/3_июня_2021 г.,_17_00.gpx: 2880 точек
+	// <nil>
+}
+
+func Example_runStats() {
+	time.Local = time.UTC
+	runStats([]string{"-i=.test/3_*.gpx"})
+	// Output:
+	// .test/3_июня_2021 г.,_17_00.gpx	2021-06-03 14:00	52m12s	42m37s	17.6 км	24.10 км/ч	42.7 км/ч
+}
+
+func Example_commandErrors() {
+	tst := func(name string, args ...string) {
+		err := findCommand(name).run(args)
+		fmt.Println(errors.As(err, &usageError{}), errors.Is(err, flag.ErrHelp), err)
+	}
+	tst("convert")
+	tst("index", "-o=.test")
+	tst("index", "-o=.test/xxx", "-s=.test/index.html")
+	tst("export", "-i=.test/xxx.gpx", "-f=xml")
+	tst("export", "-i=.test/xxx.gpx", "-f=csv", "-share")
+	tst("records", "-d=1,0")
+	tst("stats", "-h")
+	// Output:
+	// true false не указан входной файл
+	// true false не указан html-файл
+	// true false выходной каталог '.test/xxx' не является каталогом
+	// true false неизвестный формат 'xml', допустимы: js, json, geojson, gpx, kml, csv
+	// true false обезличенный трек записывается только в форматах gpx и geojson вместо 'csv'
+	// true false неверное число '0'
+	// true true flag: help requested
+}
+
+func Example_runSplits() {
+	files, _ := filepath.Glob(".test/3_*.gpx")
+	fmt.Println(runSplits([]string{"-i=" + files[0], "-d=5000"}))
+	fmt.Println(runSplits([]string{"-i=" + files[0], "-laps"}))
+	// Output:
+	// №     км  длина, м   время  км/ч  высота, м  пульс
+	//   1   5.00      5000  14m18s  21.0          -      -
+	//   2  10.00      5000  14m47s  20.3          -      -
+	//   3  15.00      5000  16m12s  18.5          -      -
+	//   4  17.63      2631   6m55s  22.8          -      -
+	// <nil>
+	// в треке нет кругов
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gpx2js/track"
+)
+
+// configName - имя файла настроек проекта, который ищется в текущем каталоге
+const configName = "gpx2js.json"
+
+// config - настройки проекта. Флаги командной строки имеют приоритет над ними
+type config struct {
+	Input      []string           `json:"input"`      // файловые маски и каталоги входных GPX-файлов
+	Include    []string           `json:"include"`    // маски файлов, отбираемых в каталогах
+	Exclude    []string           `json:"exclude"`    // маски пропускаемых файлов и каталогов
+	Output     string             `json:"output"`     // каталог json-данных поездок
+	HTML       []string           `json:"html"`       // html-файлы, в которые вписываются ссылки на json-данные
+	Manifest   string             `json:"manifest"`   // манифест json-данных поездок вместо ссылок на каждую поездку
+	Pages      []pageSpec         `json:"pages"`      // страницы, собираемые по шаблонам с данными поездок
+	Heatmap    *heatmapSpec       `json:"heatmap"`    // теплокарта всех поездок
+	Map        *mapSpec           `json:"map"`        // карты поездок на тайлах из локального каталога
+	Vector     *vectorSpec        `json:"vector"`     // векторные тайлы всех поездок
+	Explorer   *explorerSpec      `json:"explorer"`   // исследованные поездками тайлы
+	Records    *recordsSpec       `json:"records"`    // личные рекорды поездок
+	Thumbnails *thumbSpec         `json:"thumbnails"` // миниатюры поездок
+	URL        string             `json:"url"`        // адрес сайта для ссылок OpenGraph, корень сайта - каталог файла настроек
+	Profile    string             `json:"profile"`    // профиль фильтрации точек
+	Format     string             `json:"format"`     // форматы json-данных поездок через запятую
+	Precision  track.Precision    `json:"precision"`  // количество знаков после запятой в json-данных
+	Splits     float64            `json:"splits"`     // длина отрезков разбивки поездок в json-данных в метрах, 0 - без разбивки
+	Pipeline   []track.FilterSpec `json:"pipeline"`   // этапы обработки точек вместо профиля фильтрации
+	Privacy    []track.Zone       `json:"privacy"`    // зоны приватности, в которых скрываются начало и конец треков
+
+	path string // путь прочитанного файла настроек, пустой - файл не найден
+}
+
+// newConfig возвращает настройки по умолчанию
+func newConfig() *config {
+	return &config{
+		Include:   []string{"*.gpx"},
+		Output:    ".",
+		Profile:   defaultProfile,
+		Format:    "js",
+		Precision: track.DefaultPrecision,
+	}
+}
+
+// loadConfig читает файл настроек. Относительные пути в нем отсчитываются от каталога файла
+func loadConfig(file string) (*config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newConfig()
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err = d.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	cfg.path = file
+	dir := filepath.Dir(file)
+	for i := range cfg.Input {
+		cfg.Input[i] = resolvePath(dir, cfg.Input[i])
+	}
+	cfg.Output = resolvePath(dir, cfg.Output)
+	for i := range cfg.HTML {
+		cfg.HTML[i] = resolvePath(dir, cfg.HTML[i])
+	}
+	cfg.Manifest = resolvePath(dir, cfg.Manifest)
+	if cfg.Heatmap != nil {
+		cfg.Heatmap.Output = resolvePath(dir, cfg.Heatmap.Output)
+		cfg.Heatmap.State = resolvePath(dir, cfg.Heatmap.State)
+		cfg.Heatmap.setDefaults()
+	}
+	if cfg.Vector != nil {
+		cfg.Vector.Output = resolvePath(dir, cfg.Vector.Output)
+		cfg.Vector.setDefaults()
+	}
+	if cfg.Explorer != nil {
+		cfg.Explorer.Output = resolvePath(dir, cfg.Explorer.Output)
+		cfg.Explorer.setDefaults()
+	}
+	if cfg.Records != nil {
+		cfg.Records.Output = resolvePath(dir, cfg.Records.Output)
+		cfg.Records.setDefaults()
+	}
+	if cfg.Map != nil {
+		cfg.Map.Tiles = resolvePath(dir, cfg.Map.Tiles)
+		cfg.Map.Output = resolvePath(dir, cfg.Map.Output)
+		cfg.Map.setDefaults()
+	}
+	if cfg.Thumbnails != nil {
+		cfg.Thumbnails.Output = resolvePath(dir, cfg.Thumbnails.Output)
+		if cfg.Thumbnails.Size == 0 {
+			cfg.Thumbnails.Size = defaultThumbSize
+		}
+	}
+	for i := range cfg.Pages {
+		cfg.Pages[i].Template = resolvePath(dir, cfg.Pages[i].Template)
+		cfg.Pages[i].Output = resolvePath(dir, cfg.Pages[i].Output)
+	}
+	return cfg, nil
+}
+
+// resolvePath раскрывает ~ в начале пути и отсчитывает относительный путь от каталога dir
+func resolvePath(dir string, p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, p[1:])
+		}
+	}
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// findConfig возвращает путь файла настроек в текущем каталоге или пустую строку, если его там нет
+func findConfig() string {
+	if fi, err := os.Stat(configName); err == nil && !fi.IsDir() {
+		return configName
+	}
+	return ""
+}
+
+// loadConfigArgs читает файл настроек, заданный флагом -c среди args, или файл из
+// текущего каталога. Если файла нет, возвращаются настройки по умолчанию
+func loadConfigArgs(args []string) (*config, error) {
+	file := configFlag(args)
+	if file == "" {
+		if file = findConfig(); file == "" {
+			return newConfig(), nil
+		}
+	}
+	return loadConfig(file)
+}
+
+// configFlag возвращает значение флага -c до того, как будут разобраны остальные флаги
+func configFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if len(name) == len(arg) || len(arg)-len(name) > 2 {
+			continue
+		}
+		if name == "c" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "c=") {
+			return name[2:]
+		}
+	}
+	return ""
+}
+
+// check проверяет настройки и возвращает список найденных ошибок
+func (cfg *config) check() (errs []error) {
+	for _, list := range [][]string{cfg.Input, cfg.Include, cfg.Exclude} {
+		for _, pattern := range list {
+			if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+				errs = append(errs, fmt.Errorf("неверная файловая маска '%s': %s", pattern, err.Error()))
+			}
+		}
+	}
+	if err := checkDir(cfg.Output, "выходной"); err != nil {
+		errs = append(errs, err)
+	}
+	for _, html := range cfg.HTML {
+		if _, _, err := readHtml(html); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, page := range cfg.Pages {
+		if err := page.check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Heatmap != nil {
+		if err := cfg.Heatmap.check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Vector != nil {
+		if err := cfg.Vector.check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Explorer != nil {
+		if err := cfg.Explorer.check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Records != nil {
+		if err := cfg.Records.check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Map != nil {
+		if err := cfg.Map.check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Thumbnails != nil {
+		if err := cfg.Thumbnails.check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := cfg.pipeline(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkFormat(cfg.Format); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.checkPrecision(); err != nil {
+		errs = append(errs, err)
+	}
+	return
+}
+
+// needsRides проверяет, что кроме ссылок в html-файлах надо собрать манифест, страницы,
+// миниатюры, карты, теплокарту, векторные или исследованные тайлы или рекорды по данным
+// всех поездок
+func (cfg *config) needsRides() bool {
+	return cfg.Manifest != "" || len(cfg.Pages) > 0 || cfg.Thumbnails != nil || cfg.Map != nil || cfg.Heatmap != nil ||
+		cfg.Vector != nil || cfg.Explorer != nil || cfg.Records != nil
+}
+
+// checkPrecision проверяет количество знаков после запятой для каждого поля json-данных и
+// длину отрезков разбивки поездок
+func (cfg *config) checkPrecision() error {
+	p := cfg.Precision
+	switch {
+	case p.LL < 0 || p.LL > 10:
+		return fmt.Errorf("точность координат %d вне диапазона 0..10", p.LL)
+	case p.DT < 0 || p.DT > 3:
+		return fmt.Errorf("точность интервалов времени %d вне диапазона 0..3", p.DT)
+	case p.DD < 0 || p.DD > 6:
+		return fmt.Errorf("точность расстояний %d вне диапазона 0..6", p.DD)
+	case p.EL < 0 || p.EL > 3:
+		return fmt.Errorf("точность высот %d вне диапазона 0..3", p.EL)
+	case cfg.Splits != 0 && (cfg.Splits < 100 || cfg.Splits > 100000):
+		return fmt.Errorf("длина отрезков разбивки %g м вне диапазона 100..100000", cfg.Splits)
+	}
+	return nil
+}
+
+// checkFormat проверяет названия форматов json-данных поездок, перечисленных через запятую
+func checkFormat(format string) error {
+	_, err := parseFormats(format)
+	return err
+}
+
+// parseFormats возвращает форматы, перечисленные через запятую, без повторов
+func parseFormats(format string) ([]track.Format, error) {
+	var formats []track.Format
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(format, ",") {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		f, err := track.ParseFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// pipeline возвращает этапы обработки точек из настроек или из профиля фильтрации и
+// последним этапом - скрытие начала и конца треков в зонах приватности, если они заданы
+func (cfg *config) pipeline() (track.Pipeline, error) {
+	var p track.Pipeline
+	if len(cfg.Pipeline) > 0 {
+		var err error
+		if p, err = track.NewPipeline(cfg.Pipeline); err != nil {
+			return nil, err
+		}
+	} else {
+		prof, ok := profiles[cfg.Profile]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный профиль фильтрации '%s'", cfg.Profile)
+		}
+		p = prof.Pipeline()
+	}
+	if len(cfg.Privacy) == 0 {
+		return p, nil
+	}
+	for _, z := range cfg.Privacy {
+		if err := z.Check(); err != nil {
+			return nil, err
+		}
+	}
+	// зоны приватности проверяются последними по уже обработанным точкам
+	return append(p, track.Privacy{Zones: cfg.Privacy}), nil
+}
+
+// formats возвращает форматы json-данных поездок с точностью и разбивкой из настроек
+func (cfg *config) formats() ([]track.Format, error) {
+	formats, err := parseFormats(cfg.Format)
+	for i := range formats {
+		formats[i].Precision = cfg.Precision
+		formats[i].Splits = cfg.Splits
+	}
+	return formats, err
+}
+
+// format возвращает единственный формат json-данных поездок с точностью и разбивкой из настроек
+func (cfg *config) format() (track.Format, error) {
+	formats, err := cfg.formats()
+	if err != nil {
+		return track.Format{}, err
+	}
+	if len(formats) > 1 {
+		return track.Format{}, fmt.Errorf("нужен один формат вместо '%s'", cfg.Format)
+	}
+	return formats[0], nil
+}
+
+func runConfig(args []string) error {
+	flags := newFlagSet("config check", "Проверяет файл настроек "+configName)
+	var file string
+	flags.StringVar(&file, "c", "", "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
+	if len(args) < 1 || args[0] != "check" {
+		flags.Usage()
+		return usageError{errors.New("не указано действие check")}
+	}
+	if err := parseFlags(flags, args[1:], nil); err != nil {
+		return err
+	}
+	if file == "" {
+		if file = findConfig(); file == "" {
+			return fmt.Errorf("файл настроек %s не найден", configName)
+		}
+	}
+	cfg, err := loadConfig(file)
+	if err != nil {
+		return err
+	}
+	errs := cfg.check()
+	for _, err := range errs {
+		fmt.Printf("%s: %s\n", file, err.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("в файле настроек '%s' ошибок: %d", file, len(errs))
+	}
+	fmt.Printf("%s: ошибок нет\n", file)
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gpx2js/track"
+)
+
+func Test_loadConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, configName)
+	data := `{
+		"input": ["gpx/*.gpx", "/data/*.gpx"],
+		"output": "routes",
+		"html": ["index.html"],
+		"profile": "walking",
+		"precision": {"ll": 5}
+	}`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Input[0] != filepath.Join(dir, "gpx/*.gpx") || cfg.Input[1] != "/data/*.gpx" {
+		t.Errorf("неверные входные файлы %v", cfg.Input)
+	}
+	if cfg.Output != filepath.Join(dir, "routes") || cfg.HTML[0] != filepath.Join(dir, "index.html") {
+		t.Errorf("неверные выходные пути %s %v", cfg.Output, cfg.HTML)
+	}
+	if cfg.Profile != "walking" || cfg.Format != "js" || cfg.Precision != (track.Precision{LL: 5, DD: 2, EL: 1}) {
+		t.Errorf("неверные параметры %s %s %v", cfg.Profile, cfg.Format, cfg.Precision)
+	}
+	if errs := cfg.check(); len(errs) != 2 { // нет каталога routes и файла index.html
+		t.Errorf("неверный результат проверки %v", errs)
+	}
+	if err := os.WriteFile(file, []byte(`{"outpt": "routes"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(file); err == nil {
+		t.Error("неизвестное поле не обнаружено")
+	}
+}
+
+func Test_configPrivacy(t *testing.T) {
+	cfg := newConfig()
+	cfg.Privacy = []track.Zone{{Name: "дом", Lat: 59.93, Lon: 30.31, Radius: 300}}
+	p, err := cfg.pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := p[len(p)-1]; last.Name() != "privacy" {
+		t.Errorf("последний этап обработки %s вместо privacy", last.Name())
+	}
+	cfg.Privacy = append(cfg.Privacy, track.Zone{Name: "работа", Polygon: [][2]float64{{59.9, 30.3}, {59.91, 30.3}}})
+	if _, err = cfg.pipeline(); err == nil {
+		t.Error("зона с двумя вершинами многоугольника не обнаружена")
+	}
+}
+
+func Example_configFlag() {
+	fmt.Println(configFlag([]string{"-i=x.gpx", "-c", "a.json"}))
+	fmt.Println(configFlag([]string{"--c=b.json", "-o=."}))
+	fmt.Println(configFlag([]string{"-i=c.gpx", "-o", "-c"}))
+	// Output:
+	// a.json
+	// b.json
+	//
+}
+
+func Example_runConfig() {
+	err := runConfig([]string{"check", "-c=.test/gpx2js.json"})
+	fmt.Println(err)
+	// Output:
+	// .test/gpx2js.json: ошибок нет
+	// <nil>
+}
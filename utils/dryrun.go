@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gpx2js/track"
+)
+
+// действия с файлом json-данных поездки
+const (
+	actionCreate    = "создание"
+	actionOverwrite = "перезапись"
+	actionSkip      = "без изменений"
+	actionRemove    = "удаление"
+)
+
+// conversion - подготовленная конвертация GPX-файла в файлы json-данных поездки
+type conversion struct {
+	input   string              // входной GPX-файл
+	size    int64               // размер входного файла в байтах
+	outputs []output            // выходные файлы по одному на каждый формат
+	total   int                 // количество точек во входном файле
+	kept    int                 // количество точек после фильтрации
+	reports []track.StageReport // отчеты этапов обработки точек
+	dir     string              // выходной каталог
+	key     string              // ключ поездки
+	source  string              // отпечаток исходного трека для файла источников
+	stale   []string            // ключи прежних конвертаций того же трека, файлы которых удаляются
+	removed []string            // файлы прежних ключей поездки
+}
+
+// output - подготовленный выходной файл json-данных поездки
+type output struct {
+	path   string // путь выходного файла
+	action string // что будет сделано с выходным файлом
+	data   []byte // содержимое выходного файла
+}
+
+// prepareConversion читает GPX-файл и готовит содержимое файлов json-данных во всех
+// форматах настроек, не записывая их
+func prepareConversion(file string, cfg *config) (*conversion, error) {
+	p, err := cfg.pipeline()
+	if err != nil {
+		return nil, err
+	}
+	formats, err := cfg.formats()
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	t, err := readTrack(file)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := readSources(cfg.Output)
+	if err != nil {
+		return nil, err
+	}
+	if t.Len() < 1 {
+		return nil, track.ErrEmpty
+	}
+	// источник json-данных поездки на входе - исходный трек, из которого они записаны
+	rawKey, rawStart := t.Key(), t.Start()
+	source, ok := sources[rawKey]
+	if !ok || !isRouteFile(file) {
+		source = sourceID(t.Points()[0])
+	}
+	reports, err := fileStages(file, p).Process(t)
+	if err != nil {
+		return nil, err
+	}
+	c := &conversion{
+		input:   file,
+		size:    fi.Size(),
+		total:   t.Total,
+		kept:    t.Len(),
+		reports: reports,
+		dir:     cfg.Output,
+		key:     t.Key(),
+		source:  source,
+	}
+	for _, f := range formats {
+		var buf bytes.Buffer
+		if err = t.Encode(&buf, f); err != nil {
+			return nil, err
+		}
+		out := output{path: path.Join(cfg.Output, t.Key()+f.Ext()), data: buf.Bytes()}
+		prev, err := os.ReadFile(out.path)
+		switch {
+		case os.IsNotExist(err):
+			out.action = actionCreate
+		case err != nil:
+			return nil, err
+		case bytes.Equal(prev, out.data):
+			out.action = actionSkip
+		default:
+			out.action = actionOverwrite
+		}
+		c.outputs = append(c.outputs, out)
+	}
+	// ключ меняется, например, когда в зоне приватности скрывается начало трека
+	for key, id := range sources {
+		if id == c.source && key != c.key {
+			c.stale = append(c.stale, key)
+		}
+	}
+	// json-данные, записанные до файла источников, принадлежат треку, только если начинаются
+	// с его первой точки
+	if _, ok := sources[rawKey]; !ok && rawKey != c.key && sameStart(cfg.Output, rawKey, formats, rawStart) {
+		c.stale = append(c.stale, rawKey)
+	}
+	sort.Strings(c.stale)
+	for _, key := range c.stale {
+		c.removed = append(c.removed, rideFiles(cfg, formats, key)...)
+	}
+	return c, nil
+}
+
+// sameStart проверяет, что json-данные поездки key в каталоге dir начинаются в момент start
+func sameStart(dir string, key string, formats []track.Format, start time.Time) bool {
+	for _, f := range formats {
+		t, err := readTrack(path.Join(dir, key+f.Ext()))
+		if err == nil {
+			return t.Start().Equal(start)
+		}
+	}
+	return false
+}
+
+// rideFiles возвращает существующие файлы поездки key: json-данные во всех форматах и
+// миниатюры, карту и страницы поездки из настроек
+func rideFiles(cfg *config, formats []track.Format, key string) []string {
+	var files []string
+	for _, f := range formats {
+		files = append(files, path.Join(cfg.Output, key+f.Ext()))
+	}
+	if cfg.Thumbnails != nil {
+		files = append(files, cfg.Thumbnails.path(key, ".svg"), cfg.Thumbnails.path(key, ".png"))
+	}
+	if cfg.Map != nil {
+		files = append(files, filepath.Join(cfg.Map.Output, key+".png"))
+	}
+	for _, page := range cfg.Pages {
+		if page.Each == eachRide {
+			files = append(files, page.output(&ride{ID: key}, 0))
+		}
+	}
+	var res []string
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			res = append(res, file)
+		}
+	}
+	return res
+}
+
+// sourcesName - имя скрытого файла источников json-данных поездок в выходном каталоге
+const sourcesName = ".sources.json"
+
+// rideSources - источники json-данных поездок выходного каталога: отпечатки исходных
+// треков по ключам поездок. По ним конвертация находит json-данные, записанные прежними
+// конвертациями того же трека под другим ключом
+type rideSources map[string]string
+
+// sourceID возвращает отпечаток трека по его первой точке до обработки. По отпечатку нельзя
+// узнать ни время, ни место начала трека
+func sourceID(p track.Point) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%.6f,%.6f,%d", p.Lat, p.Lon, p.Time.UnixNano())))
+	return hex.EncodeToString(sum[:8])
+}
+
+// readSources читает файл источников каталога dir, если его нет - возвращает пустые источники
+func readSources(dir string) (rideSources, error) {
+	sources := make(rideSources)
+	file := filepath.Join(dir, sourcesName)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return sources, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return sources, nil
+}
+
+// writeSources записывает файл источников каталога dir, если он изменился
+func writeSources(dir string, sources rideSources) error {
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeChanged(filepath.Join(dir, sourcesName), append(data, '\n'))
+}
+
+// write записывает выходные файлы, содержимое которых изменилось
+func (c *conversion) write() error {
+	for _, out := range c.outputs {
+		if out.action == actionSkip {
+			continue
+		}
+		if err := writeFileAtomic(out.path, out.data, 0644); err != nil {
+			return err
+		}
+	}
+	for _, file := range c.removed {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// файл источников перечитывается, потому что он мог измениться после подготовки
+	sources, err := readSources(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, key := range c.stale {
+		delete(sources, key)
+	}
+	sources[c.key] = c.source
+	return writeSources(c.dir, sources)
+}
+
+// paths возвращает пути выходных файлов
+func (c *conversion) paths() []string {
+	paths := make([]string, len(c.outputs))
+	for i, out := range c.outputs {
+		paths[i] = out.path
+	}
+	return paths
+}
+
+// outputSize возвращает суммарный размер выходных файлов в байтах
+func (c *conversion) outputSize() (size int64) {
+	for _, out := range c.outputs {
+		size += int64(len(out.data))
+	}
+	return
+}
+
+// sizeReport - размер файлов и количество точек до и после конвертации
+type sizeReport struct {
+	files  int   // количество входных файлов
+	before int64 // размер входных файлов в байтах
+	after  int64 // размер выходных файлов в байтах
+	total  int   // количество точек во входных файлах
+	kept   int   // количество оставшихся точек
+}
+
+// add добавляет в отчет конвертацию c и возвращает отчет только по ней
+func (r *sizeReport) add(c *conversion) sizeReport {
+	one := sizeReport{1, c.size, c.outputSize(), c.total, c.kept}
+	r.files++
+	r.before += one.before
+	r.after += one.after
+	r.total += one.total
+	r.kept += one.kept
+	return one
+}
+
+func (r sizeReport) String() string {
+	var percent float64
+	if r.before > 0 {
+		percent = float64(r.after) * 100 / float64(r.before)
+	}
+	return fmt.Sprintf("размер %d -> %d байт (%.1f%%), точек %d -> %d", r.before, r.after, percent, r.total, r.kept)
+}
+
+// printReports выводит отчеты этапов обработки точек
+func (c *conversion) printReports(w io.Writer) {
+	for _, r := range c.reports {
+		fmt.Fprintf(w, "\t%s: %s\n", r.Stage, r.Report)
+	}
+}
+
+// printPlan выводит, что сделала бы конвертация файлов files, не изменяя выходной каталог,
+// и как после нее изменился бы блок ссылок html-файлов настроек
+func printPlan(w io.Writer, files []string, cfg *config) error {
+	var sizes sizeReport
+	routes, err := outputRoutes(cfg)
+	if err != nil {
+		return err
+	}
+	planned := make(map[string]bool)
+	for _, route := range routes {
+		planned[filepath.Clean(route)] = true
+	}
+	for _, file := range files {
+		c, err := prepareConversion(file, cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		for _, out := range c.outputs {
+			fmt.Fprintf(w, "%s -> %s: %s, точек %d -> %d, байт %d -> %d\n",
+				c.input, out.path, out.action, c.total, c.kept, c.size, len(out.data))
+			if filepath.Ext(out.path) == ".js" {
+				planned[filepath.Clean(out.path)] = true
+			}
+		}
+		for _, file := range c.removed {
+			fmt.Fprintf(w, "%s: %s\n", file, actionRemove)
+			delete(planned, filepath.Clean(file))
+		}
+		c.printReports(w)
+		sizes.add(c)
+	}
+	if len(files) > 1 {
+		fmt.Fprintf(w, "итого файлов %d: %s\n", sizes.files, sizes)
+	}
+	routes = routes[:0]
+	for route := range planned {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return printHtmlPlan(w, cfg, routes)
+}
+
+// outputRoutes возвращает отсортированный список js-файлов json-данных поездок выходного
+// каталога настроек, в html-файлы вписываются ссылки только на них. Каталога может еще не быть
+func outputRoutes(cfg *config) ([]string, error) {
+	routes, err := filepath.Glob(path.Join(cfg.Output, "*.js"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(routes)
+	return routes, nil
+}
+
+// printIndexPlan выводит, что сделала бы пересборка html-файлов и сайта по json-данным
+// поездок выходного каталога, ничего не записывая
+func printIndexPlan(w io.Writer, cfg *config) error {
+	routes, err := outputRoutes(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Manifest != "" {
+		fmt.Fprintf(w, "%s: поездок %d\n", cfg.Manifest, len(routes))
+	}
+	if cfg.Heatmap != nil {
+		fmt.Fprintf(w, "%s: теплокарта масштабов %d..%d\n", cfg.Heatmap.Output, cfg.Heatmap.MinZoom, cfg.Heatmap.MaxZoom)
+	}
+	if cfg.Vector != nil {
+		fmt.Fprintf(w, "%s: векторные тайлы масштабов %d..%d\n", cfg.Vector.Output, cfg.Vector.MinZoom, cfg.Vector.MaxZoom)
+	}
+	if cfg.Explorer != nil {
+		fmt.Fprintf(w, "%s: исследованные тайлы масштабов %v\n", cfg.Explorer.Output, cfg.Explorer.Zooms)
+	}
+	if cfg.Records != nil {
+		fmt.Fprintf(w, "%s: рекорды на дистанциях %v км и за %v мин\n", cfg.Records.Output, cfg.Records.Dists, cfg.Records.Times)
+	}
+	if cfg.Map != nil {
+		fmt.Fprintf(w, "%s: карт поездок %d по тайлам %s\n", cfg.Map.Output, len(routes), cfg.Map.Tiles)
+	}
+	if cfg.Thumbnails != nil {
+		fmt.Fprintf(w, "%s: миниатюр поездок %d\n", cfg.Thumbnails.Output, len(routes))
+	}
+	for _, page := range cfg.Pages {
+		fmt.Fprintf(w, "%s: сборка по шаблону %s, поездок %d\n", page.Output, page.templateName(), len(routes))
+	}
+	return printHtmlPlan(w, cfg, routes)
+}
+
+// printHtmlPlan выводит изменения блока ссылок каждого html-файла настроек при json-данных
+// поездок routes
+func printHtmlPlan(w io.Writer, cfg *config, routes []string) error {
+	for _, html := range cfg.HTML {
+		prevLines, blockLines, _, err := readHtmlBlock(html)
+		if err != nil {
+			return err
+		}
+		lines, err := htmlBlockLines(cfg, html, routes)
+		if err != nil {
+			return err
+		}
+		diff := diffLines(blockLines, lines)
+		if len(diff) == 0 {
+			fmt.Fprintf(w, "%s: %s\n", html, actionSkip)
+			continue
+		}
+		fmt.Fprintf(w, "%s: строка %d <!-- begin of routers -->\n", html, len(prevLines))
+		for _, line := range diff {
+			fmt.Fprintln(w, line)
+		}
+	}
+	return nil
+}
+
+// diffLines возвращает удаленные (-) и добавленные (+) строки, превращающие a в b
+func diffLines(a []string, b []string) (diff []string) {
+	// длины наибольших общих подпоследовательностей хвостов a[i:] и b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+	return
+}
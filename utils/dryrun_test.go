@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpx2js/track"
+)
+
+func Example_diffLines() {
+	for _, line := range diffLines([]string{"a", "b", "c", "d"}, []string{"a", "c", "d", "e"}) {
+		fmt.Println(line)
+	}
+	// Output:
+	// -b
+	// +e
+}
+
+func Example_printPlan() {
+	// в пустом выходном каталоге блок ссылок html-файла состоит из будущих json-данных
+	os.MkdirAll(".test/plan", 0755)
+	defer os.RemoveAll(".test/plan")
+	cfg := newConfig()
+	cfg.Output = ".test/plan"
+	cfg.HTML = []string{".test/index.html"}
+	files, _ := globInput(".test/2_*.gpx")
+	if err := printPlan(os.Stdout, files, cfg); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// .test/2_июня_2021 г.,_15_19.gpx -> .test/plan/1622636398.js: создание, точек 1332 -> 1244, байт 262879 -> 36504
+	// 	dedupe: удалено точек 88, изменено 0
+	// 	outliers: удалено точек 0, изменено 0
+	// 	smooth: удалено точек 0, изменено 1239
+	// .test/index.html: строка 11 <!-- begin of routers -->
+	// -    <script src="routes/1620740955.js"></script>
+	// -    <script src="routes/1620828488.js"></script>
+	// -    <script src="routes/1620915156.js"></script>
+	// -    <script src="routes/1620916245.js"></script>
+	// -    <script src="routes/1621000412.js"></script>
+	// -    <script src="routes/1621073174.js"></script>
+	// +    <script src="plan/1622636398.js"></script>
+}
+
+func Example_printIndexPlan() {
+	cfg := newConfig()
+	cfg.Output = ".test"
+	cfg.HTML = []string{".test/index.html"}
+	if err := printIndexPlan(os.Stdout, cfg); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// .test/index.html: строка 11 <!-- begin of routers -->
+	// -    <script src="routes/1620740955.js"></script>
+	// -    <script src="routes/1620828488.js"></script>
+	// -    <script src="routes/1620915156.js"></script>
+	// -    <script src="routes/1620916245.js"></script>
+	// -    <script src="routes/1621000412.js"></script>
+	// -    <script src="routes/1621073174.js"></script>
+	// +    <script src="1622636398.js"></script>
+	// +    <script src="1622728859.js"></script>
+	// +    <script src="1650362321.js"></script>
+}
+
+func Example_sizeReport() {
+	var r sizeReport
+	r.add(&conversion{size: 1000, total: 10, kept: 8, outputs: []output{{data: make([]byte, 150)}}})
+	one := r.add(&conversion{size: 3000, total: 30, kept: 20, outputs: []output{{data: make([]byte, 200)}, {data: make([]byte, 100)}}})
+	fmt.Println(one)
+	fmt.Println(r)
+	// Output:
+	// размер 3000 -> 300 байт (10.0%), точек 30 -> 20
+	// размер 4000 -> 450 байт (11.2%), точек 40 -> 28
+}
+
+// zonePoints возвращает точки json-данных поездок каталога dir, лежащие в зоне z
+func zonePoints(t *testing.T, dir string, z track.Zone) (n int) {
+	rides, err := loadRides(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rides {
+		for _, p := range r.track.Points() {
+			if z.Contains(p) {
+				n++
+			}
+		}
+	}
+	return
+}
+
+func Test_convertPrivacy(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newConfig()
+	cfg.Output = filepath.Join(dir, "routes")
+	cfg.Manifest = filepath.Join(dir, "routes", "index.json")
+	cfg.Thumbnails = &thumbSpec{Output: filepath.Join(dir, "thumbs"), Size: defaultThumbSize}
+	cfg.Pages = []pageSpec{{Each: eachRide, Output: filepath.Join(dir, "rides", "{id}.html")}}
+	if err := os.MkdirAll(cfg.Output, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files, err := globInput(".test/2_*.gpx")
+	if err != nil || len(files) != 1 {
+		t.Fatal(files, err)
+	}
+	convert := func(file string) {
+		if _, err := convertFile(file, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := updateHtmls(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	convert(files[0])
+	rides, err := loadRides(cfg.Output)
+	if err != nil || len(rides) != 1 {
+		t.Fatal(rides, err)
+	}
+	// другая поездка, ключ которой попадает во время исходного трека, не удаляется
+	other := meridianTrack()
+	for i := range other.Segments[0].Points {
+		other.Segments[0].Points[i].Time = rides[0].Start.Add(time.Duration(i+1) * time.Minute)
+	}
+	format, err := cfg.format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = other.Encode(&buf, format); err != nil {
+		t.Fatal(err)
+	}
+	otherFile := filepath.Join(cfg.Output, other.Key()+format.Ext())
+	if err = os.WriteFile(otherFile, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	home := rides[0].track.Points()[0]
+	zone := track.Zone{Name: "дом", Lat: home.Lat, Lon: home.Lon, Radius: 300}
+	if zonePoints(t, cfg.Output, zone) == 0 {
+		t.Fatal("в зоне нет точек поездки")
+	}
+	// после включения зоны приватности ключ поездки меняется, а файлы прежнего ключа удаляются
+	cfg.Privacy = []track.Zone{zone}
+	convert(files[0])
+	check := func(oldID string) {
+		if n := zonePoints(t, cfg.Output, zone); n > 0 {
+			t.Errorf("в json-данных поездок точек в зоне приватности %d", n)
+		}
+		err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(file)
+			if strings.Contains(file, oldID) || strings.Contains(string(data), oldID) {
+				t.Errorf("%s: остался прежний ключ поездки %s", file, oldID)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(rides[0].ID)
+	if _, err := os.Stat(otherFile); err != nil {
+		t.Errorf("удалена другая поездка: %s", err)
+	}
+	for _, file := range rideFiles(cfg, []track.Format{format}, other.Key()) {
+		if err = os.Remove(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// json-данные поездки на входе тоже проходят зоны приватности
+	if rides, err = loadRides(cfg.Output); err != nil || len(rides) != 1 {
+		t.Fatal(rides, err)
+	}
+	zone.Radius = 1000
+	cfg.Privacy = []track.Zone{zone}
+	convert(rides[0].File)
+	check(rides[0].ID)
+	// при новой конвертации исходного трека удаляется ключ, записанный по json-данным
+	if rides, err = loadRides(cfg.Output); err != nil || len(rides) != 1 {
+		t.Fatal(rides, err)
+	}
+	zone.Radius = 300
+	cfg.Privacy = []track.Zone{zone}
+	convert(files[0])
+	check(rides[0].ID)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gpx2js/track"
+)
+
+// explorerSummaryName - имя файла итогов исследования тайлов в каталоге слоев
+const explorerSummaryName = "explorer.json"
+
+// defaultExplorerZooms - масштабы исследуемых тайлов по умолчанию, принятые в состязаниях
+// explorer tiles и squadrats
+var defaultExplorerZooms = []int{14, 17}
+
+// explorerSpec - настройки исследования тайлов: тайлов OSM, через которые прошла хотя бы
+// одна поездка, с наибольшим квадратом и кластером и слоями GeoJSON для страницы сайта
+type explorerSpec struct {
+	Output string `json:"output"` // каталог итогов и слоев GeoJSON
+	Zooms  []int  `json:"zooms"`  // масштабы тайлов
+}
+
+// setDefaults заполняет незаданные масштабы значениями по умолчанию
+func (s *explorerSpec) setDefaults() {
+	if len(s.Zooms) == 0 {
+		s.Zooms = append([]int(nil), defaultExplorerZooms...)
+	}
+}
+
+// check проверяет масштабы исследуемых тайлов. Каталога слоев может еще не быть
+func (s *explorerSpec) check() error {
+	for _, z := range s.Zooms {
+		if z < 1 || z > 20 {
+			return fmt.Errorf("масштаб исследуемых тайлов %d вне диапазона 1..20", z)
+		}
+	}
+	if s.Output == "" {
+		return errors.New("не указан каталог исследованных тайлов")
+	}
+	if fi, err := os.Stat(s.Output); err == nil && !fi.IsDir() {
+		return fmt.Errorf("выходной каталог '%s' не является каталогом", s.Output)
+	}
+	return nil
+}
+
+// parseZooms разбирает масштабы тайлов через запятую
+func parseZooms(s string) ([]int, error) {
+	var res []int
+	for _, f := range strings.Split(s, ",") {
+		z, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("неверный масштаб тайлов '%s'", f)
+		}
+		res = append(res, z)
+	}
+	return res, nil
+}
+
+// tileXY - тайл x/y одного масштаба
+type tileXY struct {
+	x, y int
+}
+
+// tileSet - множество тайлов одного масштаба
+type tileSet map[tileXY]bool
+
+// sorted возвращает тайлы множества по строкам сверху вниз и слева направо
+func (ts tileSet) sorted() []tileXY {
+	res := make([]tileXY, 0, len(ts))
+	for t := range ts {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].y < res[j].y || (res[i].y == res[j].y && res[i].x < res[j].x)
+	})
+	return res
+}
+
+// rideTiles возвращает тайлы масштаба z, через которые проходит трек t. Тайлы отрезков
+// между точками перебираются по пересечениям с границами тайлов, поэтому учитывается и
+// тайл, угол которого отрезок лишь задевает
+func rideTiles(t *track.Track, z int) tileSet {
+	n := math.Exp2(float64(z))
+	res := make(tileSet)
+	add := func(x int, y int) {
+		if y >= 0 && float64(y) < n {
+			res[tileXY{x, y}] = true
+		}
+	}
+	var x0, y0 float64
+	for i, p := range t.Points() {
+		x1, y1 := track.Mercator(p.Lat, p.Lon)
+		x1, y1 = x1*n, y1*n
+		if i == 0 {
+			add(int(math.Floor(x1)), int(math.Floor(y1)))
+		} else {
+			segmentTiles(x0, y0, x1, y1, add)
+		}
+		x0, y0 = x1, y1
+	}
+	return res
+}
+
+// segmentTiles вызывает add для тайлов, через которые проходит отрезок (x0, y0) - (x1, y1)
+// в единицах тайлов, кроме тайла его начала
+func segmentTiles(x0 float64, y0 float64, x1 float64, y1 float64, add func(x int, y int)) {
+	tx, ty := int(math.Floor(x0)), int(math.Floor(y0))
+	steps := abs(int(math.Floor(x1))-tx) + abs(int(math.Floor(y1))-ty)
+	// доля отрезка до пересечения следующей границы тайла и шаг доли между границами
+	axis := func(a0 float64, a1 float64, t int) (step int, next float64, delta float64) {
+		switch {
+		case a1 > a0:
+			return 1, (float64(t+1) - a0) / (a1 - a0), 1 / (a1 - a0)
+		case a1 < a0:
+			return -1, (a0 - float64(t)) / (a0 - a1), 1 / (a0 - a1)
+		}
+		return 0, math.Inf(1), math.Inf(1)
+	}
+	stepX, nextX, deltaX := axis(x0, x1, tx)
+	stepY, nextY, deltaY := axis(y0, y1, ty)
+	for i := 0; i < steps; i++ {
+		if nextX < nextY {
+			tx, nextX = tx+stepX, nextX+deltaX
+		} else {
+			ty, nextY = ty+stepY, nextY+deltaY
+		}
+		add(tx, ty)
+	}
+}
+
+// abs возвращает модуль целого числа
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// explorerSquare - наибольший квадрат исследованных тайлов
+type explorerSquare struct {
+	X    int `json:"x"`    // левый тайл квадрата
+	Y    int `json:"y"`    // верхний тайл квадрата
+	Size int `json:"size"` // сторона квадрата в тайлах
+}
+
+// maxSquare возвращает наибольший квадрат, все тайлы которого есть в множестве ts. Из
+// равных квадратов выбирается тот, чей правый нижний угол идет раньше по строкам
+func maxSquare(ts tileSet) explorerSquare {
+	var res explorerSquare
+	// сторона наибольшего квадрата с правым нижним углом в тайле
+	size := make(map[tileXY]int, len(ts))
+	for _, t := range ts.sorted() {
+		s := 1 + minInt(size[tileXY{t.x - 1, t.y}], minInt(size[tileXY{t.x, t.y - 1}], size[tileXY{t.x - 1, t.y - 1}]))
+		size[t] = s
+		if s > res.Size {
+			res = explorerSquare{t.x - s + 1, t.y - s + 1, s}
+		}
+	}
+	return res
+}
+
+// maxCluster возвращает наибольший кластер множества ts: связную по сторонам группу тайлов,
+// у каждого из которых все четыре соседних тайла тоже есть в множестве
+func maxCluster(ts tileSet) tileSet {
+	inner := make(tileSet)
+	for t := range ts {
+		if ts[tileXY{t.x - 1, t.y}] && ts[tileXY{t.x + 1, t.y}] && ts[tileXY{t.x, t.y - 1}] && ts[tileXY{t.x, t.y + 1}] {
+			inner[t] = true
+		}
+	}
+	res := make(tileSet)
+	seen := make(tileSet)
+	for _, start := range inner.sorted() {
+		if seen[start] {
+			continue
+		}
+		cluster := make(tileSet)
+		stack := []tileXY{start}
+		seen[start] = true
+		for len(stack) > 0 {
+			t := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			cluster[t] = true
+			for _, nb := range []tileXY{{t.x - 1, t.y}, {t.x + 1, t.y}, {t.x, t.y - 1}, {t.x, t.y + 1}} {
+				if inner[nb] && !seen[nb] {
+					seen[nb] = true
+					stack = append(stack, nb)
+				}
+			}
+		}
+		if len(cluster) > len(res) {
+			res = cluster
+		}
+	}
+	return res
+}
+
+// explorerRide - исследованные тайлы поездки
+type explorerRide struct {
+	ID    string `json:"id"`    // ключ поездки
+	Tiles int    `json:"tiles"` // тайлов, через которые прошла поездка
+	New   int    `json:"new"`   // тайлов, в которых до этой поездки не было ни одной
+}
+
+// explorerStats - итоги исследования тайлов одного масштаба
+type explorerStats struct {
+	Zoom    int            `json:"zoom"`
+	Tiles   int            `json:"tiles"`   // исследованных тайлов всего
+	Square  explorerSquare `json:"square"`  // наибольший квадрат
+	Cluster int            `json:"cluster"` // тайлов в наибольшем кластере
+	Rides   []explorerRide `json:"rides"`   // поездки по времени начала
+}
+
+func (s explorerStats) String() string {
+	return fmt.Sprintf("z%d: тайлов %d, наибольший квадрат %dx%d, наибольший кластер %d",
+		s.Zoom, s.Tiles, s.Square.Size, s.Square.Size, s.Cluster)
+}
+
+// geoFeature - объект Feature формата GeoJSON
+type geoFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoGeometry            `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// geoGeometry - геометрия объекта GeoJSON
+type geoGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// geoCollection - объект FeatureCollection формата GeoJSON
+type geoCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+}
+
+// tileCorner возвращает координаты долгота, широта левого верхнего угла тайла x/y
+// масштаба z, округленные до 6 знаков после запятой
+func tileCorner(z int, x int, y int) [2]float64 {
+	n := math.Exp2(float64(z))
+	lat, lon := track.InverseMercator(float64(x)/n, float64(y)/n)
+	return [2]float64{math.Round(lon*1e6) / 1e6, math.Round(lat*1e6) / 1e6}
+}
+
+// tilePolygons возвращает мультиполигон GeoJSON тайлов множества ts масштаба z. Соседние
+// тайлы одной строки объединяются в один прямоугольник
+func tilePolygons(ts tileSet, z int) geoGeometry {
+	polygons := [][][][2]float64{}
+	tiles := ts.sorted()
+	for i := 0; i < len(tiles); {
+		j := i + 1
+		for j < len(tiles) && tiles[j].y == tiles[i].y && tiles[j].x == tiles[j-1].x+1 {
+			j++
+		}
+		x0, x1, y := tiles[i].x, tiles[j-1].x+1, tiles[i].y
+		polygons = append(polygons, [][][2]float64{{
+			tileCorner(z, x0, y), tileCorner(z, x0, y+1), tileCorner(z, x1, y+1), tileCorner(z, x1, y), tileCorner(z, x0, y),
+		}})
+		i = j
+	}
+	return geoGeometry{"MultiPolygon", polygons}
+}
+
+// explorerLayer - слои GeoJSON исследованных тайлов одного масштаба на странице сайта
+type explorerLayer struct {
+	Zoom    int    `json:"zoom"`
+	Tiles   string `json:"tiles"`   // адрес слоя новых тайлов каждой поездки
+	Square  string `json:"square"`  // адрес слоя наибольшего квадрата
+	Cluster string `json:"cluster"` // адрес слоя наибольшего кластера
+}
+
+// explorerFiles возвращает пути слоев GeoJSON тайлов масштаба z в каталоге dir
+func explorerFiles(dir string, z int) explorerLayer {
+	name := func(layer string) string {
+		return filepath.Join(dir, layer+"-"+strconv.Itoa(z)+".geojson")
+	}
+	return explorerLayer{z, name("tiles"), name("square"), name("cluster")}
+}
+
+// explorerLayers возвращает слои исследованных тайлов для страницы из каталога dir
+func explorerLayers(s *explorerSpec, dir string) ([]explorerLayer, error) {
+	var res []explorerLayer
+	for _, z := range s.Zooms {
+		l := explorerFiles(s.Output, z)
+		for _, file := range []*string{&l.Tiles, &l.Square, &l.Cluster} {
+			rel, err := relPath(dir, *file)
+			if err != nil {
+				return nil, err
+			}
+			*file = filepath.ToSlash(rel)
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// writeExplorer вычисляет исследованные поездками rides тайлы всех масштабов настроек,
+// записывает итоги и слои GeoJSON: новые тайлы каждой поездки, наибольший квадрат и
+// наибольший кластер, и возвращает итоги по масштабам
+func writeExplorer(s *explorerSpec, rides []ride) ([]explorerStats, error) {
+	if err := os.MkdirAll(s.Output, 0755); err != nil {
+		return nil, err
+	}
+	var res []explorerStats
+	for _, z := range s.Zooms {
+		stats := explorerStats{Zoom: z, Rides: []explorerRide{}}
+		all := make(tileSet)
+		tiles := geoCollection{"FeatureCollection", []geoFeature{}}
+		for _, r := range rides {
+			if r.track == nil || r.track.Len() < 1 {
+				continue
+			}
+			visited := rideTiles(r.track, z)
+			added := make(tileSet)
+			for t := range visited {
+				if !all[t] {
+					all[t], added[t] = true, true
+				}
+			}
+			stats.Rides = append(stats.Rides, explorerRide{r.ID, len(visited), len(added)})
+			if len(added) > 0 {
+				tiles.Features = append(tiles.Features, geoFeature{"Feature", tilePolygons(added, z),
+					map[string]interface{}{"id": r.ID, "date": r.Start.Local().Format("2006-01-02"), "new": len(added)}})
+			}
+		}
+		stats.Tiles = len(all)
+		stats.Square = maxSquare(all)
+		cluster := maxCluster(all)
+		stats.Cluster = len(cluster)
+		square := make(tileSet)
+		for x := 0; x < stats.Square.Size; x++ {
+			for y := 0; y < stats.Square.Size; y++ {
+				square[tileXY{stats.Square.X + x, stats.Square.Y + y}] = true
+			}
+		}
+		files := explorerFiles(s.Output, z)
+		layers := []struct {
+			file string
+			data geoCollection
+		}{
+			{files.Tiles, tiles},
+			{files.Square, geoCollection{"FeatureCollection", []geoFeature{{"Feature", tilePolygons(square, z),
+				map[string]interface{}{"size": stats.Square.Size}}}}},
+			{files.Cluster, geoCollection{"FeatureCollection", []geoFeature{{"Feature", tilePolygons(cluster, z),
+				map[string]interface{}{"tiles": stats.Cluster}}}}},
+		}
+		for _, l := range layers {
+			data, err := json.Marshal(l.data)
+			if err != nil {
+				return nil, err
+			}
+			if err = writeChanged(l.file, append(data, '\n')); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, stats)
+	}
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return res, writeChanged(filepath.Join(s.Output, explorerSummaryName), append(data, '\n'))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_segmentTiles(t *testing.T) {
+	tst := func(x0 float64, y0 float64, x1 float64, y1 float64, goal []tileXY) {
+		var res []tileXY
+		segmentTiles(x0, y0, x1, y1, func(x int, y int) { res = append(res, tileXY{x, y}) })
+		if !reflect.DeepEqual(res, goal) {
+			t.Errorf("segmentTiles(%v, %v, %v, %v) = %v вместо %v", x0, y0, x1, y1, res, goal)
+		}
+	}
+	tst(0.5, 0.5, 0.7, 0.2, nil)
+	tst(0.5, 0.5, 2.5, 0.5, []tileXY{{1, 0}, {2, 0}})
+	tst(2.5, 0.5, 0.5, 0.5, []tileXY{{1, 0}, {0, 0}})
+	// по диагонали отрезок проходит и через один из двух тайлов у общего угла
+	tst(0.5, 0.9, 1.2, 1.5, []tileXY{{0, 1}, {1, 1}})
+	tst(0.9, 0.5, 1.5, 1.2, []tileXY{{1, 0}, {1, 1}})
+	tst(0.5, 1.5, 0.5, -0.5, []tileXY{{0, 0}, {0, -1}})
+}
+
+// testTiles возвращает множество тайлов по строкам, в которых '#' - исследованный тайл
+func testTiles(rows ...string) tileSet {
+	ts := make(tileSet)
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				ts[tileXY{x, y}] = true
+			}
+		}
+	}
+	return ts
+}
+
+func Test_maxSquareCluster(t *testing.T) {
+	ts := testTiles(
+		"#####...",
+		"####.###",
+		"#####.##",
+		"####..##",
+		"#.....##",
+	)
+	if sq := maxSquare(ts); sq != (explorerSquare{0, 0, 4}) {
+		t.Errorf("наибольший квадрат %+v", sq)
+	}
+	cluster := maxCluster(ts)
+	if goal := testTiles("", ".##", ".###"); !reflect.DeepEqual(cluster, goal) {
+		t.Errorf("наибольший кластер %v вместо %v", cluster.sorted(), goal.sorted())
+	}
+	if sq := maxSquare(make(tileSet)); sq.Size != 0 {
+		t.Errorf("квадрат пустого множества %+v", sq)
+	}
+}
+
+func Test_writeExplorer(t *testing.T) {
+	spec := &explorerSpec{Output: filepath.Join(t.TempDir(), "explorer"), Zooms: []int{14, 17}}
+	if err := spec.check(); err != nil {
+		t.Fatal(err)
+	}
+	a, b := testRide(0), testRide(time.Hour)
+	stats, err := writeExplorer(spec, []ride{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("итогов масштабов %d вместо 2", len(stats))
+	}
+	for _, zs := range stats {
+		// трек вдоль меридиана длиной 4,5 км - столбец тайлов без квадрата больше 1 и кластера
+		if zs.Tiles == 0 || zs.Square.Size != 1 || zs.Cluster != 0 {
+			t.Errorf("%s", zs)
+		}
+		if len(zs.Rides) != 2 || zs.Rides[0].New != zs.Tiles || zs.Rides[1].Tiles != zs.Tiles || zs.Rides[1].New != 0 {
+			t.Errorf("z%d: новые тайлы поездок %+v", zs.Zoom, zs.Rides)
+		}
+	}
+	data, err := os.ReadFile(explorerFiles(spec.Output, 14).Tiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tiles geoCollection
+	if err = json.Unmarshal(data, &tiles); err != nil {
+		t.Fatal(err)
+	}
+	if len(tiles.Features) != 1 || tiles.Features[0].Properties["id"] != a.ID {
+		t.Errorf("слой новых тайлов: %s", data)
+	}
+}
@@ -2,187 +2,45 @@ package main
 
 import (
 	"bufio"
-	"encoding/xml"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"math"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"time"
-)
-
-type point struct {
-	Lat  float64   `xml:"lat,attr"` //широта в градусах
-	Lon  float64   `xml:"lon,attr"` //долгота в градусах
-	Time time.Time `xml:"time"`     //Время UTC
-	Dist float64   //Расстояние от предыдущей точки в метрах
-}
-
-const maxSpeed = 40   //максимальная адекватная скорость в м/с
-const smoothCount = 3 //количество соседних точек назад и вперед для сглаживания
-const smoothTime = 3  //интервал в секундах назад и вперед для сглаживания
 
-// deg2rad преобразует значение угла из градусов в радианы
-func deg2rad(deg float64) float64 {
-	return deg * math.Pi / 180
-}
+	"gpx2js/track"
+)
 
-// distance возвращает расстояние в метрах между двумя географическими точками (lat1, lon1) и (lat2, lon2)
-func distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
-	const R = 6372795 //средний радиус земли в метрах
-	dLat := deg2rad(lat2 - lat1)
-	dLon := deg2rad(lon2 - lon1)
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(deg2rad(lat1))*math.Cos(deg2rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
-	dRad := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a)) // дистанция в радианах
-	return R * dRad                                      // дистанция в метрах
-}
+const defaultProfile = "cycling"
 
-func decodeGpxXml(r io.Reader) ([]point, error) {
-	var points []point
-	var prev *point
-	d := xml.NewDecoder(r)
-	for {
-		t, err := d.Token()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, err
-		}
-		switch t := t.(type) {
-		case xml.StartElement:
-			if t.Name.Local == "trkpt" {
-				var p point
-				var dist float64
-				if err := d.DecodeElement(&p, &t); err != nil {
-					return nil, err
-				}
-				if prev != nil {
-					dt := p.Time.Sub(prev.Time).Seconds()
-					if dt > 0 {
-						dist = distance(prev.Lat, prev.Lon, p.Lat, p.Lon)
-						if dist <= 0 {
-							continue
-						}
-						if dist/dt > maxSpeed {
-							continue
-						}
-					} else if dt == 0 { // время новой точки не изменилось - удаляем предыдущую, чтобы заменить ее
-						points = points[:len(points)-1]
-					} else { // время новой точки меньше предыдущей - игнорируем
-						continue
-					}
-				}
-				points = append(points, p)
-				prev = &p
-			}
-		}
-	}
-	lastPointIndex := len(points) - 1
-	// без сглаживания скоростей
-	// for i := 1; i <= lastPointIndex; i++ {
-	// 	points[i].Dist = distance(points[i-1].Lat, points[i-1].Lon, points[i].Lat, points[i].Lon)
-	// }
-	// // сглаживание скоростей по отдаленным точкам
-	for i := 1; i <= lastPointIndex; i++ {
-		l := i - smoothCount
-		if l < 0 {
-			l = 0
-		}
-		minTime := points[i].Time.Add(-time.Second * smoothTime)
-		for l < (i-1) && points[l].Time.Before(minTime) {
-			l++
-		}
-		maxTime := points[i].Time.Add(time.Second * smoothTime)
-		m := i + smoothCount
-		if m > lastPointIndex {
-			m = lastPointIndex
-		}
-		for m > i && points[m].Time.After(maxTime) {
-			m--
-		}
-		dist := distance(points[l].Lat, points[l].Lon, points[m].Lat, points[m].Lon)
-		points[i].Dist = dist / float64(m-l)
-	}
-	return points, nil
+// profiles - именованные профили фильтрации и сглаживания точек трека
+var profiles = map[string]track.Options{
+	"cycling": track.DefaultOptions,
+	"walking": {MaxSpeed: 10, SmoothCount: 5, SmoothTime: 10},
+	"raw":     {},
 }
 
-func outputVars(points []point, output string) (string, error) {
-	if len(points) < 1 {
-		return "", errors.New("в треке нет данных")
-	}
-	var w io.WriteCloser
-	var err error
-	begTime := points[0].Time
-	begTimeUnix := strconv.FormatInt(begTime.Unix(), 10)
-	if output == "" {
-		w = os.Stdout
-	} else {
-		output = path.Join(output, begTimeUnix+".js")
-		w, err = os.Create(output)
-		if err != nil {
-			return "", err
-		}
-		defer w.Close()
-	}
-	outArray := func(prefix string, suffix string, outItem func(point)) {
-		fmt.Fprintf(w, "\"%s\":[", prefix)
-		for i := 0; i < len(points); i++ {
-			if i > 0 {
-				fmt.Fprint(w, ",")
-			}
-			outItem(points[i])
-		}
-		fmt.Fprintf(w, "]%s", suffix)
-	}
-	// объект
-	fmt.Fprintf(w, "tracks['%s']={", begTimeUnix)
-	// кординаты
-	outArray("ll", ",", func(p point) {
-		fmt.Fprintf(w, "[%f,%f]", p.Lat, p.Lon)
-	})
-	// интервалы времени
-	var prev *point
-	outArray("dt", ",", func(p point) {
-		var dt float64
-		if prev != nil {
-			dt = p.Time.Sub(prev.Time).Seconds()
-		}
-		prev = &p
-		fmt.Fprintf(w, "%.0f", dt)
-	})
-	// расстояния
-	outArray("dd", "", func(p point) {
-		fmt.Fprintf(w, "%.2f", p.Dist)
-	})
-	fmt.Fprint(w, "}")
-	return output, nil
-}
-
-func parseArgs(args []string) (files []string, dest string, html string, err error) {
+// parseArgs разбирает флаги прежнего вызова без подкоманды. Флаги -o и -s заменяют
+// выходной каталог и html-файлы настроек cfg
+func parseArgs(args []string, cfg *config) (files []string, dryRun bool, err error) {
 	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	var input string
+	flags.String("c", cfg.path, "Путь файла настроек, по умолчанию "+configName+" текущего каталога")
 	flags.StringVar(&input, "i", "", "Имя входного GPX-файла или файловая маска GPX-файлов")
-	flags.StringVar(&dest, "o", ".", "Имя каталога, куда будет сохранен выходной JSON-файл")
-	flags.StringVar(&html, "s", "", "Путь html-файла, в который надо вписать ссылки на json-данные поездок")
+	flags.StringVar(&cfg.Output, "o", cfg.Output, "Имя каталога, куда будет сохранен выходной JSON-файл")
+	htmlFlag(flags, cfg, "Путь html-файла, в который надо вписать ссылки на json-данные поездок")
+	flags.BoolVar(&dryRun, "dry-run", false, "Только показать, какие файлы json-данных и блоки ссылок html-файлов изменятся, ничего не записывая")
 	err = flags.Parse(args)
 	if err == nil {
-		if input == "" {
-			err = errors.New("не указан входной файл")
-		} else {
-			files, err = filepath.Glob(input)
+		files, err = globInput(input)
+		if err == nil {
+			err = checkDir(cfg.Output, "выходной")
 		}
 		if err == nil {
-			var fi os.FileInfo
-			fi, err = os.Stat(dest)
-			if (err != nil && os.IsNotExist(err)) || (err == nil && !fi.IsDir()) {
-				err = fmt.Errorf("выходной каталог '%s' не является каталогом", dest)
-			}
+			err = checkConfig(cfg)
 		}
 	}
 	if err != nil {
@@ -192,6 +50,13 @@ func parseArgs(args []string) (files []string, dest string, html string, err err
 }
 
 func readHtml(html string) (prevLines []string, postLines []string, err error) {
+	prevLines, _, postLines, err = readHtmlBlock(html)
+	return
+}
+
+// readHtmlBlock читает html-файл, разделяя его на строки до блока ссылок на json-данные,
+// строки самого блока и строки после него
+func readHtmlBlock(html string) (prevLines []string, blockLines []string, postLines []string, err error) {
 	var mode int = 0 // 0-prev 1-in 2-post
 	var r *os.File
 	if r, err = os.Open(html); err != nil {
@@ -201,16 +66,24 @@ func readHtml(html string) (prevLines []string, postLines []string, err error) {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		var line = scanner.Text()
+		begin := strings.Contains(line, "<!-- begin of routers -->")
+		end := strings.Contains(line, "<!-- end of routers -->")
+		if (begin && (end || mode != 0)) || (end && mode != 1) {
+			err = fmt.Errorf("в файле '%s' неверная разметка местоположения ссылок на json-данные: строка %d", html, len(prevLines)+len(blockLines)+len(postLines)+1)
+			return
+		}
 		switch mode {
 		case 0:
 			prevLines = append(prevLines, line)
-			if strings.Contains(line, "<!-- begin of routers -->") {
+			if begin {
 				mode = 1
 			}
 		case 1:
-			if strings.Contains(line, "<!-- end of routers -->") {
+			if end {
 				postLines = append(postLines, line)
 				mode = 2
+			} else {
+				blockLines = append(blockLines, line)
 			}
 		case 2:
 			postLines = append(postLines, line)
@@ -226,21 +99,19 @@ func readHtml(html string) (prevLines []string, postLines []string, err error) {
 }
 
 func writeHtml(w *os.File, htmlDir string, dest string, prevLines []string, postLines []string) error {
-	files, err := filepath.Glob(path.Join(dest, "*.js"))
+	files, err := routeFiles(dest)
 	if err != nil {
 		return err
 	}
-	if len(files) < 1 {
-		return fmt.Errorf("в каталоге '%s' нет json-данных поездок", dest)
+	lines, err := routerLines(htmlDir, files)
+	if err != nil {
+		return err
 	}
 	for _, line := range prevLines {
 		fmt.Fprintln(w, line)
 	}
-	for _, file := range files {
-		if file, err = filepath.Rel(htmlDir, file); err != nil {
-			return err
-		}
-		if _, err = fmt.Fprintln(w, `    <script src="`+file+`"></script>`); err != nil {
+	for _, line := range lines {
+		if _, err = fmt.Fprintln(w, line); err != nil {
 			return err
 		}
 	}
@@ -251,41 +122,163 @@ func writeHtml(w *os.File, htmlDir string, dest string, prevLines []string, post
 	return nil
 }
 
-func main() {
-	abortIfError := func(exitCode int, err error) {
+// routeFiles возвращает отсортированный список файлов json-данных поездок каталога dest
+func routeFiles(dest string) ([]string, error) {
+	files, err := filepath.Glob(path.Join(dest, "*.js"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) < 1 {
+		return nil, fmt.Errorf("в каталоге '%s' нет json-данных поездок", dest)
+	}
+	return files, nil
+}
+
+// routerLines возвращает строки блока ссылок html-файла из каталога htmlDir на файлы json-данных
+func routerLines(htmlDir string, files []string) ([]string, error) {
+	lines := make([]string, 0, len(files))
+	for _, file := range files {
+		file, err := filepath.Rel(htmlDir, file)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nОшибка: %s", err.Error())
-			os.Exit(exitCode)
+			return nil, err
+		}
+		lines = append(lines, `    <script src="`+file+`"></script>`)
+	}
+	return lines, nil
+}
+
+// routeExts - расширения файлов json-данных поездок
+var routeExts = []string{".js", ".json", ".geojson"}
+
+// isRouteFile проверяет, что файл содержит json-данные поездки, а не GPX-данные
+func isRouteFile(file string) bool {
+	ext := filepath.Ext(file)
+	for _, e := range routeExts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// readTrack читает трек из GPX-, TCX- или FIT-файла или из файла json-данных поездки, не обрабатывая точки
+func readTrack(file string) (*track.Track, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if isRouteFile(file) {
+		return track.DecodeRoute(f)
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".tcx":
+		return track.ParseTCX(f)
+	case ".fit":
+		return track.ParseFIT(f)
+	}
+	return track.Parse(f)
+}
+
+// fileStages возвращает этапы p, которыми обрабатывается трек из файла file. json-данные
+// поездки уже обработаны, в них только скрываются начало и конец в зонах приватности,
+// которые могли появиться после конвертации
+func fileStages(file string, p track.Pipeline) track.Pipeline {
+	if !isRouteFile(file) {
+		return p
+	}
+	var res track.Pipeline
+	for _, f := range p {
+		if _, ok := f.(track.Privacy); ok {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// decodeFile читает трек из файла и обрабатывает его этапами p. Трек из файла json-данных
+// поездки обрабатывается только этапом зон приватности
+func decodeFile(file string, p track.Pipeline) (*track.Track, []track.StageReport, error) {
+	t, err := readTrack(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	reports, err := fileStages(file, p).Process(t)
+	return t, reports, err
+}
+
+// convertFile конвертирует GPX-файл file в файлы json-данных поездки в выходном каталоге настроек
+// и возвращает их пути
+func convertFile(file string, cfg *config) ([]string, error) {
+	c, err := prepareConversion(file, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return c.paths(), c.write()
+}
+
+// writeHtmlLines перезаписывает html-файл строками блока ссылок lines между строками prevLines и postLines
+func writeHtmlLines(html string, prevLines []string, lines []string, postLines []string) error {
+	var buf bytes.Buffer
+	for _, block := range [][]string{prevLines, lines, postLines} {
+		for _, line := range block {
+			buf.WriteString(line + "\n")
 		}
 	}
-	files, dest, html, err := parseArgs(os.Args[1:])
+	return writeFileAtomic(html, buf.Bytes(), 0644)
+}
+
+// updateHtml вписывает в html-файл ссылки на все json-данные поездок из каталога dest
+func updateHtml(html string, dest string) error {
+	prevLines, postLines, err := readHtml(html)
+	if err != nil {
+		return err
+	}
+	files, err := routeFiles(dest)
+	if err != nil {
+		return err
+	}
+	lines, err := routerLines(filepath.Dir(html), files)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Ошибка в параметрах: %s", err.Error())
+		return err
+	}
+	return writeHtmlLines(html, prevLines, lines, postLines)
+}
+
+func main() {
+	var err error
+	if len(os.Args) < 2 {
+		usage()
 		os.Exit(1)
 	}
-	for _, file := range files {
-		fmt.Print(file)
-		f, err := os.Open(file)
-		abortIfError(2, err)
-		points, err := decodeGpxXml(f)
-		f.Close()
-		abortIfError(3, err)
-		output, err := outputVars(points, dest)
-		abortIfError(4, err)
-		if output != "" {
-			fmt.Print(" -> " + output)
+	if c := findCommand(os.Args[1]); c != nil {
+		err = c.run(os.Args[2:])
+	} else if os.Args[1] == "-h" || os.Args[1] == "help" {
+		usage()
+		return
+	} else { // прежний вызов без подкоманды: convert и index с настройками проекта
+		var cfg *config
+		var files []string
+		var dryRun bool
+		if cfg, err = loadConfigArgs(os.Args[1:]); err == nil {
+			if files, dryRun, err = parseArgs(os.Args[1:], cfg); err != nil {
+				err = usageError{err}
+			} else if dryRun {
+				err = printPlan(os.Stdout, files, cfg)
+			} else if err = convertFiles(files, cfg, false); err == nil {
+				err = updateHtmls(cfg)
+			}
 		}
-		fmt.Println()
 	}
-	if html != "" {
-		prevLines, postLines, err := readHtml(html)
-		abortIfError(5, err)
-		if w, err := os.Create(html); err != nil {
-			abortIfError(6, err)
-		} else {
-			defer w.Close()
-			err := writeHtml(w, filepath.Dir(html), dest, prevLines, postLines)
-			abortIfError(7, err)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		if errors.As(err, &usageError{}) {
+			fmt.Fprintf(os.Stderr, "Ошибка в параметрах: %s", err.Error())
+			os.Exit(1)
 		}
+		fmt.Fprintf(os.Stderr, "\nОшибка: %s", err.Error())
+		os.Exit(2)
 	}
 }
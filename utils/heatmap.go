@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gpx2js/track"
+)
+
+// значения по умолчанию настроек теплокарты
+const (
+	defaultHeatMinZoom    = 8
+	defaultHeatMaxZoom    = 14
+	defaultHeatSaturation = 10
+)
+
+// heatStateName - имя файла состояния теплокарты в каталоге состояния
+const heatStateName = "heatmap.json"
+
+// heatmapSpec - настройки теплокарты всех поездок: пирамиды PNG-тайлов {z}/{x}/{y}.png,
+// пикселы которой тем ярче, чем больше поездок через них прошло
+type heatmapSpec struct {
+	Output     string `json:"output"`     // каталог тайлов теплокарты
+	State      string `json:"state"`      // каталог счетчиков тайлов и состояния, по умолчанию скрытый каталог рядом с каталогом тайлов
+	MinZoom    int    `json:"minZoom"`    // наименьший масштаб тайлов
+	MaxZoom    int    `json:"maxZoom"`    // наибольший масштаб тайлов
+	Saturation int    `json:"saturation"` // количество поездок, при котором цвет пиксела самый яркий
+}
+
+// setDefaults заполняет незаданные масштабы и насыщенность значениями по умолчанию
+func (s *heatmapSpec) setDefaults() {
+	if s.MinZoom == 0 && s.MaxZoom == 0 {
+		s.MinZoom, s.MaxZoom = defaultHeatMinZoom, defaultHeatMaxZoom
+	}
+	if s.Saturation == 0 {
+		s.Saturation = defaultHeatSaturation
+	}
+}
+
+// check проверяет масштабы и насыщенность теплокарты. Каталога теплокарты может еще не быть
+func (s *heatmapSpec) check() error {
+	if s.MinZoom < 0 || s.MaxZoom > 16 || s.MinZoom > s.MaxZoom {
+		return fmt.Errorf("масштабы теплокарты %d..%d вне диапазона 0..16", s.MinZoom, s.MaxZoom)
+	}
+	if s.Saturation < 1 {
+		return fmt.Errorf("насыщенность теплокарты %d меньше 1", s.Saturation)
+	}
+	if s.Output == "" {
+		return errors.New("не указан каталог теплокарты")
+	}
+	if fi, err := os.Stat(s.Output); err == nil && !fi.IsDir() {
+		return fmt.Errorf("выходной каталог '%s' не является каталогом", s.Output)
+	}
+	if filepath.Clean(s.stateDir()) == filepath.Clean(s.Output) {
+		return fmt.Errorf("каталог состояния теплокарты '%s' совпадает с каталогом тайлов", s.State)
+	}
+	return nil
+}
+
+// stateDir возвращает каталог счетчиков тайлов и состояния теплокарты. Они не публикуются
+// вместе с тайлами, поэтому по умолчанию лежат в скрытом каталоге .{output} рядом с ними
+func (s *heatmapSpec) stateDir() string {
+	if s.State != "" {
+		return s.State
+	}
+	return filepath.Join(filepath.Dir(s.Output), "."+filepath.Base(s.Output))
+}
+
+// heatState - состояние теплокарты: настройки, с которыми она собрана, и вошедшие в нее
+// поездки по ключам. При других настройках теплокарта собирается заново
+type heatState struct {
+	MinZoom    int                 `json:"minZoom"`
+	MaxZoom    int                 `json:"maxZoom"`
+	Saturation int                 `json:"saturation"`
+	Rides      map[string]heatRide `json:"rides"`
+}
+
+// heatRide - поездка в состоянии теплокарты
+type heatRide struct {
+	Dist float64    `json:"dist"` // длина поездки, по ней замечается перезапись поездки
+	BBox [4]float64 `json:"bbox"` // границы трека, по ним находятся тайлы для пересборки
+}
+
+// bboxOverlap проверяет, что границы a и b пересекаются
+func bboxOverlap(a [4]float64, b [4]float64) bool {
+	return a[0] <= b[2] && b[0] <= a[2] && a[1] <= b[3] && b[1] <= a[3]
+}
+
+// bboxTiles добавляет в tiles тайлы масштаба z, покрывающие границы bbox
+func bboxTiles(tiles map[tileKey]bool, bbox [4]float64, z int) {
+	n := int(math.Exp2(float64(z)))
+	tile := func(f float64) int { return int(math.Max(0, math.Min(float64(n-1), math.Floor(f*float64(n))))) }
+	minX, minY := track.Mercator(bbox[2], bbox[1]) // северо-западный угол
+	maxX, maxY := track.Mercator(bbox[0], bbox[3]) // юго-восточный угол
+	for x := tile(minX); x <= tile(maxX); x++ {
+		for y := tile(minY); y <= tile(maxY); y++ {
+			tiles[tileKey{z, x, y}] = true
+		}
+	}
+}
+
+// tileKey - тайл z/x/y
+type tileKey struct {
+	z, x, y int
+}
+
+// heatGrid - количество поездок через каждый пиксел тайла
+type heatGrid [tileSize * tileSize]uint16
+
+// path возвращает путь файла тайла k в каталоге dir с расширением ext
+func (k tileKey) path(dir string, ext string) string {
+	return filepath.Join(dir, strconv.Itoa(k.z), strconv.Itoa(k.x), strconv.Itoa(k.y)+ext)
+}
+
+// heatPixels возвращает пикселы масштаба z, через которые проходит трек t, по тайлам.
+// Каждый пиксел встречается один раз, даже если трек проходит через него несколько раз
+func heatPixels(t *track.Track, z int) map[tileKey][]int {
+	world := float64(tileSize) * math.Exp2(float64(z))
+	seen := make(map[[2]int]bool)
+	res := make(map[tileKey][]int)
+	add := func(x float64, y float64) {
+		px := [2]int{int(x), int(y)}
+		if seen[px] || x < 0 || y < 0 || x >= world || y >= world {
+			return
+		}
+		seen[px] = true
+		k := tileKey{z, px[0] / tileSize, px[1] / tileSize}
+		res[k] = append(res[k], (px[1]%tileSize)*tileSize+px[0]%tileSize)
+	}
+	var prevX, prevY float64
+	for i, p := range t.Points() {
+		x, y := track.Mercator(p.Lat, p.Lon)
+		x, y = x*world, y*world
+		if i > 0 {
+			// шаг не больше половины пиксела, чтобы линия была без пропусков
+			n := int(math.Ceil(2 * math.Max(math.Abs(x-prevX), math.Abs(y-prevY))))
+			for j := 1; j < n; j++ {
+				f := float64(j) / float64(n)
+				add(prevX+(x-prevX)*f, prevY+(y-prevY)*f)
+			}
+		}
+		add(x, y)
+		prevX, prevY = x, y
+	}
+	return res
+}
+
+// readGrid читает сжатые счетчики тайла, если файла нет - возвращает нулевые счетчики
+func readGrid(file string) (*heatGrid, error) {
+	g := new(heatGrid)
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	if err = binary.Read(zr, binary.LittleEndian, g); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return g, nil
+}
+
+// writeGrid записывает сжатые счетчики тайла
+func writeGrid(file string, g *heatGrid) error {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if err := binary.Write(zw, binary.LittleEndian, g); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(file, b.Bytes(), 0644)
+}
+
+// heatColor возвращает цвет пиксела, через который прошло count поездок: от полупрозрачного
+// цвета трека для одной поездки до желтого при насыщенности saturation
+func heatColor(count uint16, saturation int) color.NRGBA {
+	f := 1.0
+	if saturation > 1 {
+		f = math.Min(1, math.Log(float64(count))/math.Log(float64(saturation)))
+	}
+	lerp := func(a float64, b float64) uint8 { return uint8(math.Round(a + (b-a)*f)) }
+	return color.NRGBA{lerp(0xe6, 0xff), lerp(0x00, 0xe6), lerp(0xaa, 0x00), lerp(0x90, 0xff)}
+}
+
+// encodeHeatTile возвращает PNG-тайл теплокарты по счетчикам g
+func encodeHeatTile(g *heatGrid, saturation int) ([]byte, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, tileSize, tileSize))
+	for i, count := range g {
+		if count > 0 {
+			img.SetNRGBA(i%tileSize, i/tileSize, heatColor(count, saturation))
+		}
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// heatReport - итоги обновления теплокарты
+type heatReport struct {
+	added   int  // добавлено поездок
+	changed int  // удалено и перезаписано поездок
+	tiles   int  // записано тайлов
+	full    bool // теплокарта собрана заново
+}
+
+func (r heatReport) String() string {
+	s := fmt.Sprintf("добавлено поездок %d, записано тайлов %d", r.added, r.tiles)
+	if r.changed > 0 {
+		s += fmt.Sprintf(", удалено и перезаписано поездок %d", r.changed)
+	}
+	if r.full {
+		s += ", теплокарта собрана заново"
+	}
+	return s
+}
+
+// updateHeatmap добавляет в теплокарту поездки rides, которых в ней еще нет. Тайлы, через
+// которые проходили удаленные поездки или прежние треки перезаписанных с тем же ключом
+// поездок, считаются заново по всем поездкам. Если изменились настройки или задан full,
+// теплокарта собирается заново
+func updateHeatmap(s *heatmapSpec, rides []ride, full bool) (heatReport, error) {
+	var report heatReport
+	state := heatState{MinZoom: s.MinZoom, MaxZoom: s.MaxZoom, Saturation: s.Saturation, Rides: make(map[string]heatRide)}
+	for _, r := range rides {
+		state.Rides[r.ID] = heatRide{r.Dist, r.BBox}
+	}
+	stateDir := s.stateDir()
+	stateFile := filepath.Join(stateDir, heatStateName)
+	done := make(map[string]bool)  // поездки, уже учтенные в теплокарте
+	known := make(map[string]bool) // поездки из состояния теплокарты
+	var stale [][4]float64         // границы треков, тайлы которых считаются заново
+	if data, err := os.ReadFile(stateFile); err == nil && !full {
+		var prev heatState
+		if err = json.Unmarshal(data, &prev); err != nil {
+			return report, fmt.Errorf("%s: %s", stateFile, err.Error())
+		}
+		full = prev.MinZoom != s.MinZoom || prev.MaxZoom != s.MaxZoom || prev.Saturation != s.Saturation
+		for id, hr := range prev.Rides {
+			known[id] = true
+			cur, ok := state.Rides[id]
+			switch {
+			case !ok:
+				stale = append(stale, hr.BBox)
+				report.changed++
+			case math.Abs(cur.Dist-hr.Dist) > 1e-6 || cur.BBox != hr.BBox:
+				stale = append(stale, hr.BBox, cur.BBox)
+				report.changed++
+			default:
+				done[id] = true
+			}
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return report, err
+	} else {
+		full = true
+	}
+	if full {
+		if err := clearHeatmap(s); err != nil {
+			return report, err
+		}
+		done, known = make(map[string]bool), make(map[string]bool)
+		stale = nil
+		report.changed = 0
+		report.full = true
+	}
+	for _, r := range rides {
+		if !done[r.ID] && !known[r.ID] {
+			report.added++
+		}
+	}
+	// масштабы обрабатываются по очереди, чтобы в памяти были счетчики тайлов только одного масштаба
+	for z := s.MinZoom; z <= s.MaxZoom && (len(done) < len(rides) || len(stale) > 0); z++ {
+		grids := make(map[tileKey]*heatGrid)
+		recount := make(map[tileKey]bool)
+		for _, bbox := range stale {
+			bboxTiles(recount, bbox, z)
+		}
+		for k := range recount {
+			grids[k] = new(heatGrid)
+		}
+		for _, r := range rides {
+			if done[r.ID] && !overlapsAny(r.BBox, stale) {
+				continue
+			}
+			for k, pixels := range heatPixels(r.track, z) {
+				// уже учтенная поездка добавляется только в считаемые заново тайлы
+				if done[r.ID] && !recount[k] {
+					continue
+				}
+				g, ok := grids[k]
+				if !ok {
+					var err error
+					if g, err = readGrid(k.path(stateDir, ".grid")); err != nil {
+						return report, err
+					}
+					grids[k] = g
+				}
+				for _, i := range pixels {
+					if g[i] < math.MaxUint16 {
+						g[i]++
+					}
+				}
+			}
+		}
+		for k, g := range grids {
+			if *g == (heatGrid{}) {
+				// через тайл больше не проходит ни одна поездка
+				for _, file := range []string{k.path(stateDir, ".grid"), k.path(s.Output, ".png")} {
+					if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+						return report, err
+					}
+				}
+				continue
+			}
+			for _, dir := range []string{stateDir, s.Output} {
+				if err := os.MkdirAll(filepath.Dir(k.path(dir, "")), 0755); err != nil {
+					return report, err
+				}
+			}
+			if err := writeGrid(k.path(stateDir, ".grid"), g); err != nil {
+				return report, err
+			}
+			data, err := encodeHeatTile(g, s.Saturation)
+			if err != nil {
+				return report, err
+			}
+			if err = writeFileAtomic(k.path(s.Output, ".png"), data, 0644); err != nil {
+				return report, err
+			}
+			report.tiles++
+		}
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return report, err
+	}
+	if err = os.MkdirAll(stateDir, 0755); err != nil {
+		return report, err
+	}
+	return report, writeFileAtomic(stateFile, append(data, '\n'), 0644)
+}
+
+// overlapsAny проверяет, что границы bbox пересекаются с какими-нибудь из границ list
+func overlapsAny(bbox [4]float64, list [][4]float64) bool {
+	for _, b := range list {
+		if bboxOverlap(bbox, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearHeatmap удаляет тайлы теплокарты из ее каталога, не трогая другие файлы, и каталог
+// счетчиков и состояния. Счетчики и состояние, которые прежние версии хранили вместе с
+// тайлами, удаляются вместе с каталогами масштабов
+func clearHeatmap(s *heatmapSpec) error {
+	if err := os.RemoveAll(s.stateDir()); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.Output, heatStateName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return clearTiles(s.Output)
+}
+
+// clearTiles удаляет из каталога dir каталоги масштабов тайлов {z}, не трогая другие
+// файлы, и создает каталог, если его нет
+func clearTiles(dir string) error {
+	for z := 0; z <= 16; z++ {
+		zdir := filepath.Join(dir, strconv.Itoa(z))
+		if _, err := os.Stat(zdir); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(zdir); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// tileLayer - слой тайлов на странице сайта
+type tileLayer struct {
+	URL     string `json:"url"`     // шаблон адреса тайлов для Leaflet
+	MinZoom int    `json:"minZoom"` // наименьший масштаб тайлов
+	MaxZoom int    `json:"maxZoom"` // наибольший масштаб тайлов, при большем тайлы растягиваются
+}
+
+// newTileLayer возвращает слой тайлов с расширением ext из каталога output масштабов
+// minZoom..maxZoom для страницы из каталога dir
+func newTileLayer(dir string, output string, ext string, minZoom int, maxZoom int) (*tileLayer, error) {
+	rel, err := relPath(dir, output)
+	if err != nil {
+		return nil, err
+	}
+	return &tileLayer{filepath.ToSlash(rel) + "/{z}/{x}/{y}" + ext, minZoom, maxZoom}, nil
+}
+
+// heatmapTiles возвращает слой теплокарты для страницы из каталога dir
+func heatmapTiles(s *heatmapSpec, dir string) (*tileLayer, error) {
+	return newTileLayer(dir, s.Output, ".png", s.MinZoom, s.MaxZoom)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gpx2js/track"
+)
+
+// testRide возвращает поездку по треку вдоль меридиана, начатую со сдвигом shift
+func testRide(shift time.Duration) ride {
+	t := meridianTrack()
+	for i := range t.Segments[0].Points {
+		t.Segments[0].Points[i].Time = t.Segments[0].Points[i].Time.Add(shift)
+	}
+	return ride{ID: t.Key(), Start: t.Start(), Stats: t.Stats(), track: t}
+}
+
+// heatCount возвращает количество поездок через пиксел масштаба 13 в точке lat, lon
+func heatCount(t *testing.T, spec *heatmapSpec, lat float64, lon float64) uint16 {
+	x, y := track.Mercator(lat, lon)
+	world := tileSize * math.Exp2(13)
+	px, py := int(x*world), int(y*world)
+	g, err := readGrid(tileKey{13, px / tileSize, py / tileSize}.path(spec.stateDir(), ".grid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g[(py%tileSize)*tileSize+px%tileSize]
+}
+
+func Test_updateHeatmap(t *testing.T) {
+	spec := &heatmapSpec{Output: filepath.Join(t.TempDir(), "heatmap"), MinZoom: 12, MaxZoom: 13, Saturation: 2}
+	if err := spec.check(); err != nil {
+		t.Fatal(err)
+	}
+	a, b := testRide(0), testRide(time.Hour)
+	report, err := updateHeatmap(spec, []ride{a}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.added != 1 || !report.full || report.tiles == 0 {
+		t.Errorf("первая сборка: %s", report)
+	}
+	report, err = updateHeatmap(spec, []ride{a, b}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.added != 1 || report.full {
+		t.Errorf("добавление поездки: %s", report)
+	}
+	// пиксел середины трека на масштабе 13 пройден обеими поездками
+	if n := heatCount(t, spec, 59.93, 30.3); n != 2 {
+		t.Errorf("через пиксел прошло поездок %d вместо 2", n)
+	}
+	// в каталоге тайлов публикуются только PNG-тайлы
+	err = filepath.Walk(spec.Output, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() && filepath.Ext(path) != ".png" {
+			t.Errorf("в каталоге тайлов файл %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = updateHeatmap(spec, []ride{b}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.added != 0 || report.changed != 1 || report.full || report.tiles == 0 {
+		t.Errorf("удаление поездки: %s", report)
+	}
+	if n := heatCount(t, spec, 59.93, 30.3); n != 1 {
+		t.Errorf("после удаления поездки через пиксел прошло поездок %d вместо 1", n)
+	}
+	// поездка перезаписана с тем же ключом треком в другом месте
+	moved := testRide(time.Hour)
+	for i := range moved.track.Segments[0].Points {
+		moved.track.Segments[0].Points[i].Lon += 0.2
+	}
+	moved.Stats = moved.track.Stats()
+	report, err = updateHeatmap(spec, []ride{moved}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.added != 0 || report.changed != 1 || report.full {
+		t.Errorf("перезапись поездки: %s", report)
+	}
+	if n := heatCount(t, spec, 59.93, 30.3); n != 0 {
+		t.Errorf("прежний трек перезаписанной поездки остался в теплокарте: %d", n)
+	}
+	if n := heatCount(t, spec, 59.93, 30.5); n != 1 {
+		t.Errorf("через пиксел нового трека прошло поездок %d вместо 1", n)
+	}
+	x, y := track.Mercator(59.93, 30.3)
+	k := tileKey{13, int(x * math.Exp2(13)), int(y * math.Exp2(13))}
+	if _, err := os.Stat(k.path(spec.Output, ".png")); !os.IsNotExist(err) {
+		t.Errorf("тайл без поездок не удален: %v", err)
+	}
+}
+
+func Test_heatColor(t *testing.T) {
+	if c := heatColor(1, 10); c.R != 0xe6 || c.G != 0 || c.A != 0x90 {
+		t.Errorf("цвет одной поездки %v", c)
+	}
+	if c := heatColor(20, 10); c.R != 0xff || c.G != 0xe6 || c.A != 0xff {
+		t.Errorf("цвет насыщенного пиксела %v", c)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// inputSet собирает список входных файлов без повторов
+type inputSet struct {
+	include []string // маски файлов, отбираемых при обходе каталогов
+	exclude []string // маски файлов и каталогов, которые пропускаются
+	files   []string
+	seen    map[string]bool
+}
+
+func newInputSet(include []string, exclude []string) *inputSet {
+	return &inputSet{include: include, exclude: exclude, seen: make(map[string]bool)}
+}
+
+// expandInputs возвращает файлы по файловым маскам и каталогам inputs. Каталоги обходятся
+// рекурсивно с отбором файлов по маскам include, маска ** соответствует любому числу каталогов
+func expandInputs(inputs []string, include []string, exclude []string) ([]string, error) {
+	s := newInputSet(include, exclude)
+	for _, input := range inputs {
+		if err := s.addInput(input); err != nil {
+			return nil, err
+		}
+	}
+	return s.files, nil
+}
+
+// addInput добавляет файлы по файловой маске или каталогу
+func (s *inputSet) addInput(input string) error {
+	if fi, err := os.Stat(input); err == nil && fi.IsDir() {
+		return s.addDir(input, s.include)
+	}
+	if i := strings.Index(filepath.ToSlash(input), "**"); i >= 0 {
+		// каталоги до сегмента с ** раскрываем обычной маской, остальное сравниваем при обходе
+		input = filepath.ToSlash(input)
+		base, rest := ".", input
+		if j := strings.LastIndex(input[:i], "/"); j >= 0 {
+			base, rest = input[:j], input[j+1:]
+			if base == "" {
+				base = "/"
+			}
+		}
+		dirs, err := filepath.Glob(filepath.FromSlash(base))
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			if err := s.addDir(dir, []string{rest}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	files, err := filepath.Glob(input)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !s.excluded(file, filepath.Base(file)) {
+			s.add(file)
+		}
+	}
+	return nil
+}
+
+// addDir рекурсивно обходит каталог dir и добавляет файлы, относительный путь которых
+// соответствует одной из масок patterns
+func (s *inputSet) addDir(dir string, patterns []string) error {
+	return filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if s.excluded(rel, fi.Name()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.IsDir() && matchAny(patterns, rel, fi.Name()) {
+			s.add(file)
+		}
+		return nil
+	})
+}
+
+func (s *inputSet) add(file string) {
+	file = filepath.Clean(file)
+	if !s.seen[file] {
+		s.seen[file] = true
+		s.files = append(s.files, file)
+	}
+}
+
+func (s *inputSet) excluded(rel string, name string) bool {
+	return matchAny(s.exclude, filepath.ToSlash(rel), name)
+}
+
+// matchAny проверяет соответствие файла хотя бы одной маске. Маска без / сравнивается
+// с именем файла name, маска с / - с относительным путем rel
+func matchAny(patterns []string, rel string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		if strings.Contains(pattern, "/") || strings.Contains(pattern, "**") {
+			if matchPath(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+				return true
+			}
+		} else if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath сравнивает сегменты пути с сегментами маски, в которой ** соответствует
+// любому числу сегментов
+func matchPath(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchPath(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchPath(pattern[1:], segments[1:])
+}
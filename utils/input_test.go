@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_expandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{
+		"2021/05/a.gpx",
+		"2021/06/b.gpx",
+		"2021/06/b.txt",
+		"2022/05/c.gpx",
+		"2022/archive/d.gpx",
+		"e.gpx",
+	} {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tst := func(inputs []string, include []string, exclude []string, goal string) {
+		for i := range inputs {
+			inputs[i] = filepath.Join(dir, filepath.FromSlash(inputs[i]))
+		}
+		files, err := expandInputs(inputs, include, exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range files {
+			files[i], _ = filepath.Rel(dir, files[i])
+			files[i] = filepath.ToSlash(files[i])
+		}
+		if strings.Join(files, " ") != goal {
+			t.Errorf("%v %v %v: %v", inputs, include, exclude, files)
+		}
+	}
+	tst([]string{"."}, []string{"*.gpx"}, nil, "2021/05/a.gpx 2021/06/b.gpx 2022/05/c.gpx 2022/archive/d.gpx e.gpx")
+	tst([]string{"2021"}, []string{"*.txt"}, nil, "2021/06/b.txt")
+	tst([]string{"."}, []string{"*.gpx"}, []string{"archive", "e.*"}, "2021/05/a.gpx 2021/06/b.gpx 2022/05/c.gpx")
+	tst([]string{"**/05/*.gpx"}, nil, nil, "2021/05/a.gpx 2022/05/c.gpx")
+	tst([]string{"202?/**/*.gpx"}, nil, []string{"archive"}, "2021/05/a.gpx 2021/06/b.gpx 2022/05/c.gpx")
+	tst([]string{"2021/*/*.gpx", "2021", "**/a.gpx"}, []string{"*.gpx"}, nil, "2021/05/a.gpx 2021/06/b.gpx")
+	tst([]string{"*.gpx", "2022/05/c.gpx"}, nil, nil, "e.gpx 2022/05/c.gpx")
+}
+
+func Example_matchPath() {
+	tst := func(pattern string, file string) {
+		fmt.Println(matchPath(strings.Split(pattern, "/"), strings.Split(file, "/")))
+	}
+	tst("**/*.gpx", "a.gpx")
+	tst("**/*.gpx", "2021/05/a.gpx")
+	tst("2021/**/05/*.gpx", "2021/05/a.gpx")
+	tst("2021/**", "2022/05/a.gpx")
+	tst("*/*.gpx", "2021/05/a.gpx")
+	// Output:
+	// true
+	// true
+	// true
+	// false
+	// false
+}
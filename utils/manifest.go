@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"path/filepath"
+)
+
+// manifestEntry - описание поездки в манифесте json-данных поездок
+type manifestEntry struct {
+	ID       string     `json:"id"`              // ключ поездки
+	File     string     `json:"file"`            // путь js-файла поездки относительно манифеста
+	Date     string     `json:"date"`            // время начала поездки UTC
+	Distance float64    `json:"distance"`        // расстояние в метрах
+	Duration float64    `json:"duration"`        // время в пути в секундах
+	Moving   float64    `json:"moving"`          // время движения в секундах
+	AvgSpeed float64    `json:"avgSpeed"`        // средняя скорость движения в км/ч
+	BBox     [4]float64 `json:"bbox"`            // границы трека: минимальные широта и долгота, максимальные широта и долгота
+	Title    string     `json:"title"`           // название трека, может быть пустым
+	Thumb    string     `json:"thumb,omitempty"` // путь svg-миниатюры поездки относительно манифеста
+}
+
+// buildManifest возвращает описания поездок rides для манифеста manifest
+func buildManifest(rides []ride, manifest string) ([]manifestEntry, error) {
+	entries := make([]manifestEntry, 0, len(rides))
+	for _, r := range rides {
+		rel, err := relPath(filepath.Dir(manifest), r.File)
+		if err != nil {
+			return nil, err
+		}
+		var thumb string
+		if r.Thumb != "" {
+			if thumb, err = relPath(filepath.Dir(manifest), r.Thumb); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, manifestEntry{
+			ID:       r.ID,
+			File:     filepath.ToSlash(rel),
+			Date:     r.Start.UTC().Format("2006-01-02T15:04:05Z"),
+			Distance: math.Round(r.Dist),
+			Duration: r.Elapsed,
+			Moving:   r.Moving,
+			AvgSpeed: math.Round(r.AvgSpeed*100) / 100,
+			BBox:     r.BBox,
+			Title:    r.Title,
+			Thumb:    filepath.ToSlash(thumb),
+		})
+	}
+	return entries, nil
+}
+
+// encodeManifest возвращает содержимое манифеста: json-массив с поездкой на каждой строке
+func encodeManifest(entries []manifestEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+		buf.Write(data)
+	}
+	buf.WriteString("\n]\n")
+	return buf.Bytes(), nil
+}
+
+// writeManifest записывает манифест manifest с поездками rides
+func writeManifest(rides []ride, manifest string) error {
+	entries, err := buildManifest(rides, manifest)
+	if err != nil {
+		return err
+	}
+	data, err := encodeManifest(entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(manifest, data, 0644)
+}
+
+// manifestLines возвращает строки блока ссылок html-файла из каталога htmlDir, по которым
+// страница загружает манифест, а json-данные поездок - по мере выбора поездок
+func manifestLines(htmlDir string, manifest string) ([]string, error) {
+	rel, err := relPath(htmlDir, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return []string{`    <script>var routesManifest = '` + filepath.ToSlash(rel) + `'</script>`}, nil
+}
+
+// relPath возвращает путь target относительно каталога base, даже если один из них
+// абсолютный, а другой - относительный
+func relPath(base string, target string) (string, error) {
+	if filepath.IsAbs(base) != filepath.IsAbs(target) {
+		var err error
+		if base, err = filepath.Abs(base); err != nil {
+			return "", err
+		}
+		if target, err = filepath.Abs(target); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Rel(base, target)
+}
+
+// htmlBlockLines возвращает строки блока ссылок html-файла html: ссылку на манифест, если
+// он задан в настройках, или ссылки на json-данные поездок routes и адреса слоев теплокарты,
+// векторных и исследованных тайлов, если они заданы в настройках
+func htmlBlockLines(cfg *config, html string, routes []string) ([]string, error) {
+	var lines []string
+	var err error
+	dir := filepath.Dir(html)
+	if cfg.Manifest != "" {
+		lines, err = manifestLines(dir, cfg.Manifest)
+	} else {
+		lines, err = routerLines(dir, routes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Heatmap != nil {
+		layer, err := heatmapTiles(cfg.Heatmap, dir)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, layerLine("heatmapTiles", layer))
+	}
+	if cfg.Vector != nil {
+		layer, err := vectorTiles(cfg.Vector, dir)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, layerLine("vectorTiles", layer))
+	}
+	if cfg.Explorer != nil {
+		layers, err := explorerLayers(cfg.Explorer, dir)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, layerLine("explorerLayers", layers))
+	}
+	return lines, nil
+}
+
+// layerLine возвращает строку html-файла с переменной name слоя или слоев layer
+func layerLine(name string, layer interface{}) string {
+	data, _ := json.Marshal(layer) // структуры из строк и чисел всегда кодируются
+	return `    <script>var ` + name + ` = ` + string(data) + `</script>`
+}
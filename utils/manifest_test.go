@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_updateHtmlsManifest(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "routes")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gpx := filepath.Join(dir, "ride.gpx")
+	if err := os.WriteFile(gpx, testGpx(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	html := filepath.Join(dir, "index.html")
+	page := "<head>\n<!-- begin of routers -->\n<script src=\"routes/1.js\"></script>\n<!-- end of routers -->\n</head>\n"
+	if err := os.WriteFile(html, []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	cfg.Output = dest
+	cfg.HTML = []string{html}
+	cfg.Manifest = filepath.Join(dest, "index.json")
+	if _, err := convertFile(gpx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateHtmls(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(cfg.Manifest)
+	want := `[
+{"id":"1622728859","file":"1622728859.js","date":"2021-06-03T14:00:59Z","distance":17631,"duration":3132,"moving":2555,"avgSpeed":24.11,"bbox":[59.907525,30.255365,59.953417,30.343595],"title":"2021-06-03T14:00:59Z"}
+]
+`
+	if string(data) != want {
+		t.Errorf("неверный манифест:\n%s", data)
+	}
+	data, _ = os.ReadFile(html)
+	if !strings.Contains(string(data), "<!-- begin of routers -->\n    <script>var routesManifest = 'routes/index.json'</script>\n<!-- end of routers -->") {
+		t.Errorf("неверный html-файл:\n%s", data)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"gpx2js/track"
+)
+
+// параметры векторных тайлов Mapbox Vector Tile 2.1
+const (
+	mvtExtent  = 4096 // размер тайла в единицах координат
+	mvtBuffer  = 64   // поле вокруг тайла, в которое попадают соседние отрезки линий
+	mvtLayer   = "rides"
+	mvtVersion = 2
+)
+
+// значения по умолчанию настроек векторных тайлов
+const (
+	defaultVectorMinZoom = 5
+	defaultVectorMaxZoom = 14
+)
+
+// vectorSpec - настройки векторных тайлов всех поездок {z}/{x}/{y}.pbf со слоем rides, в
+// котором каждая поездка - линия, упрощенная для масштаба тайла, со свойствами id, date и
+// distance: ключ поездки, дата начала и расстояние в километрах
+type vectorSpec struct {
+	Output  string `json:"output"`  // каталог векторных тайлов
+	MinZoom int    `json:"minZoom"` // наименьший масштаб тайлов
+	MaxZoom int    `json:"maxZoom"` // наибольший масштаб тайлов, при большем тайлы растягиваются
+}
+
+// setDefaults заполняет незаданные масштабы значениями по умолчанию
+func (s *vectorSpec) setDefaults() {
+	if s.MinZoom == 0 && s.MaxZoom == 0 {
+		s.MinZoom, s.MaxZoom = defaultVectorMinZoom, defaultVectorMaxZoom
+	}
+}
+
+// check проверяет масштабы векторных тайлов. Каталога тайлов может еще не быть
+func (s *vectorSpec) check() error {
+	if s.MinZoom < 0 || s.MaxZoom > 16 || s.MinZoom > s.MaxZoom {
+		return fmt.Errorf("масштабы векторных тайлов %d..%d вне диапазона 0..16", s.MinZoom, s.MaxZoom)
+	}
+	if s.Output == "" {
+		return errors.New("не указан каталог векторных тайлов")
+	}
+	if fi, err := os.Stat(s.Output); err == nil && !fi.IsDir() {
+		return fmt.Errorf("выходной каталог '%s' не является каталогом", s.Output)
+	}
+	return nil
+}
+
+// pbf - буфер сообщения protobuf
+type pbf struct {
+	bytes.Buffer
+}
+
+// varint записывает число в формате varint
+func (b *pbf) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+// uint записывает поле field типа varint
+func (b *pbf) uint(field int, v uint64) {
+	b.varint(uint64(field<<3 | 0))
+	b.varint(v)
+}
+
+// bytes записывает поле field с данными произвольной длины
+func (b *pbf) bytes(field int, data []byte) {
+	b.varint(uint64(field<<3 | 2))
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+// double записывает поле field типа double
+func (b *pbf) double(field int, v float64) {
+	b.varint(uint64(field<<3 | 1))
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	b.Write(buf[:])
+}
+
+// packed записывает упакованное поле field с числами varint
+func (b *pbf) packed(field int, values []uint32) {
+	var p pbf
+	for _, v := range values {
+		p.varint(uint64(v))
+	}
+	b.bytes(field, p.Bytes())
+}
+
+// zigzag кодирует целое число со знаком для параметров команд геометрии
+func zigzag(v int) uint32 {
+	return uint32((v << 1) ^ (v >> 31))
+}
+
+// mvtFeature - линия поездки в векторном тайле
+type mvtFeature struct {
+	ride     *ride
+	geometry []uint32 // команды геометрии
+}
+
+// mvtLine возвращает точки трека t в единицах координат тайлов масштаба z, упрощенные
+// с допуском в половину пиксела тайла
+func mvtLine(t *track.Track, z int) [][2]float64 {
+	points := t.Points()
+	// размер пиксела на местности в метрах на широте начала поездки
+	pixel := 2 * math.Pi * track.EarthRadius * math.Cos(track.Deg2Rad(points[0].Lat)) / (tileSize * math.Exp2(float64(z)))
+	keep := track.SimplifyPoints(points, pixel/2)
+	world := mvtExtent * math.Exp2(float64(z))
+	var line [][2]float64
+	for i, p := range points {
+		if keep[i] {
+			x, y := track.Mercator(p.Lat, p.Lon)
+			line = append(line, [2]float64{x * world, y * world})
+		}
+	}
+	return line
+}
+
+// mvtTiles раскладывает линию поездки r масштаба z по тайлам: в тайл попадают участки
+// линии, отрезки которых пересекают тайл с полем mvtBuffer
+func mvtTiles(r *ride, z int, tiles map[tileKey][]mvtFeature) {
+	line := mvtLine(r.track, z)
+	type run struct {
+		tile   tileKey
+		points [][2]int // точки участка относительно угла тайла
+		last   int      // индекс последней точки участка в line
+	}
+	runs := make(map[tileKey][]*run)
+	n := int(math.Exp2(float64(z)))
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		minTX := maxInt(0, int(math.Floor((math.Min(a[0], b[0])-mvtBuffer)/mvtExtent)))
+		maxTX := minInt(n-1, int(math.Floor((math.Max(a[0], b[0])+mvtBuffer)/mvtExtent)))
+		minTY := maxInt(0, int(math.Floor((math.Min(a[1], b[1])-mvtBuffer)/mvtExtent)))
+		maxTY := minInt(n-1, int(math.Floor((math.Max(a[1], b[1])+mvtBuffer)/mvtExtent)))
+		for tx := minTX; tx <= maxTX; tx++ {
+			for ty := minTY; ty <= maxTY; ty++ {
+				k := tileKey{z, tx, ty}
+				local := func(p [2]float64) [2]int {
+					return [2]int{int(math.Round(p[0])) - tx*mvtExtent, int(math.Round(p[1])) - ty*mvtExtent}
+				}
+				rs := runs[k]
+				if len(rs) == 0 || rs[len(rs)-1].last != i-1 {
+					rs = append(rs, &run{tile: k, points: [][2]int{local(a)}})
+					runs[k] = rs
+				}
+				cur := rs[len(rs)-1]
+				if p := local(b); p != cur.points[len(cur.points)-1] {
+					cur.points = append(cur.points, p)
+				}
+				cur.last = i
+			}
+		}
+	}
+	for k, rs := range runs {
+		var geometry []uint32
+		var cx, cy int // курсор геометрии сохраняется между командами
+		for _, run := range rs {
+			if len(run.points) < 2 {
+				continue
+			}
+			geometry = append(geometry, 1|1<<3, zigzag(run.points[0][0]-cx), zigzag(run.points[0][1]-cy))
+			cx, cy = run.points[0][0], run.points[0][1]
+			geometry = append(geometry, uint32(2|(len(run.points)-1)<<3))
+			for _, p := range run.points[1:] {
+				geometry = append(geometry, zigzag(p[0]-cx), zigzag(p[1]-cy))
+				cx, cy = p[0], p[1]
+			}
+		}
+		if len(geometry) > 0 {
+			tiles[k] = append(tiles[k], mvtFeature{r, geometry})
+		}
+	}
+}
+
+// encodeMVT возвращает векторный тайл со слоем mvtLayer из линий поездок features
+func encodeMVT(features []mvtFeature) []byte {
+	keys := []string{"id", "date", "distance"}
+	var values []pbf // значения свойств без повторов
+	index := make(map[string]uint32)
+	value := func(kind string, encode func(v *pbf)) uint32 {
+		var v pbf
+		encode(&v)
+		id := kind + v.String()
+		i, ok := index[id]
+		if !ok {
+			i = uint32(len(values))
+			index[id] = i
+			values = append(values, v)
+		}
+		return i
+	}
+	var layer pbf
+	layer.uint(15, mvtVersion)
+	layer.bytes(1, []byte(mvtLayer))
+	for _, f := range features {
+		r := f.ride
+		var feature pbf
+		if id, err := strconv.ParseUint(r.ID, 10, 64); err == nil {
+			feature.uint(1, id)
+		}
+		feature.packed(2, []uint32{
+			0, value("s", func(v *pbf) { v.bytes(1, []byte(r.ID)) }),
+			1, value("s", func(v *pbf) { v.bytes(1, []byte(r.Start.Local().Format("2006-01-02"))) }),
+			2, value("d", func(v *pbf) { v.double(3, math.Round(r.Dist/100)/10) }),
+		})
+		feature.uint(3, 2) // LINESTRING
+		feature.packed(4, f.geometry)
+		layer.bytes(2, feature.Bytes())
+	}
+	for _, k := range keys {
+		layer.bytes(3, []byte(k))
+	}
+	for _, v := range values {
+		layer.bytes(4, v.Bytes())
+	}
+	layer.uint(5, mvtExtent)
+	var tile pbf
+	tile.bytes(3, layer.Bytes())
+	return tile.Bytes()
+}
+
+// vectorStateName - имя файла состояния векторных тайлов в их каталоге
+const vectorStateName = "vector.json"
+
+// vectorState - состояние векторных тайлов: масштабы, с которыми они собраны, и ключи
+// вошедших в них поездок
+type vectorState struct {
+	MinZoom int      `json:"minZoom"`
+	MaxZoom int      `json:"maxZoom"`
+	Rides   []string `json:"rides"`
+}
+
+// writeVectorTiles записывает векторные тайлы всех поездок rides заново и возвращает
+// количество записанных тайлов. Если поездки и масштабы не изменились и json-данные поездок
+// не новее тайлов, тайлы не записываются и возвращается 0
+func writeVectorTiles(s *vectorSpec, rides []ride) (int, error) {
+	state := vectorState{MinZoom: s.MinZoom, MaxZoom: s.MaxZoom, Rides: []string{}}
+	files := make([]string, 0, len(rides))
+	for _, r := range rides {
+		state.Rides = append(state.Rides, r.ID)
+		files = append(files, r.File)
+	}
+	sort.Strings(state.Rides)
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	data = append(data, '\n')
+	stateFile := filepath.Join(s.Output, vectorStateName)
+	if prev, err := os.ReadFile(stateFile); err == nil && bytes.Equal(prev, data) && upToDate(stateFile, files...) {
+		return 0, nil
+	}
+	if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := clearTiles(s.Output); err != nil {
+		return 0, err
+	}
+	var count int
+	// масштабы обрабатываются по очереди, чтобы в памяти были линии тайлов только одного масштаба
+	for z := s.MinZoom; z <= s.MaxZoom; z++ {
+		tiles := make(map[tileKey][]mvtFeature)
+		for i := range rides {
+			if rides[i].track != nil && rides[i].track.Len() > 1 {
+				mvtTiles(&rides[i], z, tiles)
+			}
+		}
+		for k, features := range tiles {
+			file := k.path(s.Output, ".pbf")
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return count, err
+			}
+			if err := writeFileAtomic(file, encodeMVT(features), 0644); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, writeFileAtomic(stateFile, data, 0644)
+}
+
+// vectorTiles возвращает слой векторных тайлов для страницы из каталога dir
+func vectorTiles(s *vectorSpec, dir string) (*tileLayer, error) {
+	return newTileLayer(dir, s.Output, ".pbf", s.MinZoom, s.MaxZoom)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gpx2js/track"
+)
+
+// pbField - поле сообщения protobuf
+type pbField struct {
+	num  int
+	v    uint64 // значение varint или fixed64
+	data []byte // данные поля произвольной длины
+}
+
+// decodePbf разбирает сообщение protobuf на поля
+func decodePbf(t *testing.T, data []byte) []pbField {
+	var res []pbField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		f := pbField{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.v, n = binary.Uvarint(data)
+			data = data[n:]
+		case 1:
+			f.v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			f.data, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			t.Fatalf("неизвестный тип поля %d", key&7)
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+// decodePacked разбирает упакованные числа varint
+func decodePacked(data []byte) []uint64 {
+	var res []uint64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		res, data = append(res, v), data[n:]
+	}
+	return res
+}
+
+func Test_encodeMVT(t *testing.T) {
+	r := testRide(0)
+	r.Dist = 4450
+	tiles := make(map[tileKey][]mvtFeature)
+	mvtTiles(&r, 12, tiles)
+	x, y := track.Mercator(59.93, 30.3)
+	k := tileKey{12, int(x * 4096), int(y * 4096)}
+	if len(tiles[k]) != 1 {
+		t.Fatalf("в тайле %v линий поездок %d вместо 1", k, len(tiles[k]))
+	}
+	fields := decodePbf(t, encodeMVT(tiles[k]))
+	if len(fields) != 1 || fields[0].num != 3 {
+		t.Fatalf("в тайле нет слоя: %v", fields)
+	}
+	var keys, values []string
+	var features [][]pbField
+	for _, f := range decodePbf(t, fields[0].data) {
+		switch f.num {
+		case 1:
+			if string(f.data) != mvtLayer {
+				t.Errorf("слой %q вместо %q", f.data, mvtLayer)
+			}
+		case 2:
+			features = append(features, decodePbf(t, f.data))
+		case 3:
+			keys = append(keys, string(f.data))
+		case 4:
+			v := decodePbf(t, f.data)[0]
+			if v.num == 3 {
+				values = append(values, formatNumber(math.Float64frombits(v.v), -1))
+			} else {
+				values = append(values, string(v.data))
+			}
+		case 5, 15:
+			if (f.num == 5 && f.v != mvtExtent) || (f.num == 15 && f.v != mvtVersion) {
+				t.Errorf("поле слоя %d = %d", f.num, f.v)
+			}
+		}
+	}
+	if len(features) != 1 {
+		t.Fatalf("линий в слое %d вместо 1", len(features))
+	}
+	props := make(map[string]string)
+	for _, f := range features[0] {
+		switch f.num {
+		case 1:
+			if f.v != 1622728800 {
+				t.Errorf("идентификатор линии %d вместо ключа поездки", f.v)
+			}
+		case 2:
+			tags := decodePacked(f.data)
+			for i := 0; i+1 < len(tags); i += 2 {
+				props[keys[tags[i]]] = values[tags[i+1]]
+			}
+		case 3:
+			if f.v != 2 {
+				t.Errorf("тип линии %d вместо LINESTRING", f.v)
+			}
+		case 4:
+			geometry := decodePacked(f.data)
+			if len(geometry) < 5 || geometry[0] != 1|1<<3 || geometry[3]&7 != 2 {
+				t.Errorf("геометрия линии не начинается с MoveTo и LineTo: %v", geometry)
+			}
+		}
+	}
+	want := map[string]string{"id": r.ID, "date": r.Start.Local().Format("2006-01-02"), "distance": "4,5"}
+	for name, v := range want {
+		if props[name] != v {
+			t.Errorf("свойство %s = %q вместо %q", name, props[name], v)
+		}
+	}
+}
+
+func Test_writeVectorTiles(t *testing.T) {
+	spec := &vectorSpec{Output: filepath.Join(t.TempDir(), "vector"), MinZoom: 10, MaxZoom: 12}
+	if err := spec.check(); err != nil {
+		t.Fatal(err)
+	}
+	a, b := testRide(0), testRide(time.Hour)
+	count, err := writeVectorTiles(spec, []ride{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 3 {
+		t.Errorf("записано тайлов %d на трех масштабах", count)
+	}
+	if count, err = writeVectorTiles(spec, []ride{a}); err != nil || count != 0 {
+		t.Errorf("без изменений записано тайлов %d, ошибка %v", count, err)
+	}
+	if count, err = writeVectorTiles(spec, []ride{a, b}); err != nil || count == 0 {
+		t.Errorf("после добавления поездки записано тайлов %d, ошибка %v", count, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// trackColor - цвет трека на сайте #e600aa
+var trackColor = color.RGBA{0xe6, 0x00, 0xaa, 0xff}
+
+// hexColor возвращает цвет в виде #rrggbb для svg и css
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// canvas - растровое изображение, на котором рисуются линии треков
+type canvas struct {
+	*image.RGBA
+}
+
+// newCanvas возвращает прозрачное изображение размером width на height пикселов
+func newCanvas(width int, height int) canvas {
+	return canvas{image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+// line рисует отрезок от (x0, y0) до (x1, y1) шириной width пикселов со скругленными концами
+func (c canvas) line(x0 float64, y0 float64, x1 float64, y1 float64, width float64, col color.RGBA) {
+	r := width / 2
+	dx, dy := x1-x0, y1-y0
+	l2 := dx*dx + dy*dy
+	minX, maxX := int(math.Floor(math.Min(x0, x1)-r)), int(math.Ceil(math.Max(x0, x1)+r))
+	minY, maxY := int(math.Floor(math.Min(y0, y1)-r)), int(math.Ceil(math.Max(y0, y1)+r))
+	b := c.Bounds()
+	minX, minY = maxInt(minX, b.Min.X), maxInt(minY, b.Min.Y)
+	maxX, maxY = minInt(maxX, b.Max.X-1), minInt(maxY, b.Max.Y-1)
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			// расстояние от центра пиксела до ближайшей точки отрезка
+			px, py := float64(x)+0.5-x0, float64(y)+0.5-y0
+			var t float64
+			if l2 > 0 {
+				t = math.Max(0, math.Min(1, (px*dx+py*dy)/l2))
+			}
+			ex, ey := px-t*dx, py-t*dy
+			if ex*ex+ey*ey <= r*r {
+				c.SetRGBA(x, y, col)
+			}
+		}
+	}
+}
+
+// disk рисует круг с центром (x, y) радиусом r пикселов и белой обводкой
+func (c canvas) disk(x float64, y float64, r float64, col color.RGBA) {
+	c.line(x, y, x, y, 2*r+2, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	c.line(x, y, x, y, 2*r, col)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gpx2js/track"
+)
+
+// defaultRecordDists - дистанции самого быстрого прохождения по умолчанию в километрах
+var defaultRecordDists = []float64{1, 5, 10, 40}
+
+// defaultRecordTimes - продолжительности наибольшей средней скорости и мощности по умолчанию в минутах
+var defaultRecordTimes = []float64{5, 20, 60}
+
+// recordsSpec - настройки личных рекордов: лучших результатов поездок каталога json-данных
+// на дистанциях и по средней скорости и мощности за время
+type recordsSpec struct {
+	Output string    `json:"output"` // файл хранилища рекордов
+	Dists  []float64 `json:"dists"`  // дистанции в километрах
+	Times  []float64 `json:"times"`  // продолжительности в минутах
+}
+
+// setDefaults заполняет незаданные дистанции и продолжительности значениями по умолчанию
+func (s *recordsSpec) setDefaults() {
+	if len(s.Dists) == 0 {
+		s.Dists = append([]float64(nil), defaultRecordDists...)
+	}
+	if len(s.Times) == 0 {
+		s.Times = append([]float64(nil), defaultRecordTimes...)
+	}
+}
+
+// check проверяет дистанции, продолжительности и файл хранилища. Файла может еще не быть
+func (s *recordsSpec) check() error {
+	for _, d := range s.Dists {
+		if d <= 0 {
+			return fmt.Errorf("дистанция рекорда %g км не больше нуля", d)
+		}
+	}
+	for _, m := range s.Times {
+		if m <= 0 {
+			return fmt.Errorf("продолжительность рекорда %g мин не больше нуля", m)
+		}
+	}
+	if s.Output == "" {
+		return errors.New("не указан файл рекордов")
+	}
+	if fi, err := os.Stat(s.Output); err == nil && fi.IsDir() {
+		return fmt.Errorf("файл рекордов '%s' является каталогом", s.Output)
+	}
+	return nil
+}
+
+// defs возвращает виды рекордов: дистанции, затем скорость и мощность за каждое время
+func (s *recordsSpec) defs() []recordDef {
+	var res []recordDef
+	for _, d := range s.Dists {
+		res = append(res, recordDef{recordDist, d * 1000})
+	}
+	for _, m := range s.Times {
+		res = append(res, recordDef{recordSpeed, m * 60}, recordDef{recordPower, m * 60})
+	}
+	return res
+}
+
+// parseNumbers разбирает положительные числа через запятую
+func parseNumbers(s string) ([]float64, error) {
+	var res []float64
+	for _, f := range strings.Split(s, ",") {
+		x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || x <= 0 {
+			return nil, fmt.Errorf("неверное число '%s'", f)
+		}
+		res = append(res, x)
+	}
+	return res, nil
+}
+
+// Виды рекордов
+const (
+	recordDist  = "dist"  // самое быстрое прохождение дистанции
+	recordSpeed = "speed" // наибольшая средняя скорость за время
+	recordPower = "power" // наибольшая средняя мощность за время
+)
+
+// recordDef - вид рекорда Kind на дистанции или за время Size метров или секунд
+type recordDef struct {
+	Kind string  `json:"kind"`
+	Size float64 `json:"size"`
+}
+
+func (d recordDef) String() string {
+	switch d.Kind {
+	case recordDist:
+		return fmt.Sprintf("%g км", d.Size/1000)
+	case recordSpeed:
+		return fmt.Sprintf("скорость %g мин", d.Size/60)
+	}
+	return fmt.Sprintf("мощность %g мин", d.Size/60)
+}
+
+// best возвращает лучший результат поездки t этого вида
+func (d recordDef) best(t *track.Track) (track.Effort, bool) {
+	switch d.Kind {
+	case recordDist:
+		return t.BestDist(d.Size)
+	case recordSpeed:
+		return t.BestSpeed(d.Size)
+	}
+	return t.BestPower(d.Size)
+}
+
+// better проверяет, что результат e лучше результата prev
+func (d recordDef) better(e track.Effort, prev track.Effort) bool {
+	switch d.Kind {
+	case recordDist:
+		return e.Time < prev.Time
+	case recordSpeed:
+		return e.Dist > prev.Dist
+	}
+	return e.Power > prev.Power
+}
+
+// result возвращает результат e для отчета: сначала величину, по которой сравниваются рекорды
+func (d recordDef) result(e track.Effort) string {
+	switch d.Kind {
+	case recordDist:
+		return fmt.Sprintf("%s, %.1f км/ч", time.Duration(math.Round(e.Time))*time.Second, e.Speed)
+	case recordSpeed:
+		return fmt.Sprintf("%.1f км/ч, %.2f км", e.Speed, e.Dist/1000)
+	}
+	return fmt.Sprintf("%.0f Вт, %.1f км/ч", e.Power, e.Speed)
+}
+
+// rideEfforts - лучшие результаты поездки в хранилище рекордов
+type rideEfforts struct {
+	Name    string          `json:"name"`    // название поездки для отчетов
+	Start   time.Time       `json:"start"`   // время начала поездки
+	Dist    float64         `json:"dist"`    // длина поездки, по ней замечается перезапись поездки
+	Efforts []*track.Effort `json:"efforts"` // результаты по видам рекордов, null - нет результата
+}
+
+// recordEntry - установление рекорда поездкой Ride
+type recordEntry struct {
+	Ride string    `json:"ride"`
+	Name string    `json:"name"`
+	Date time.Time `json:"date"` // время начала поездки
+	track.Effort
+	Beaten     string     `json:"beaten,omitempty"`     // ключ поездки, побившей рекорд
+	BeatenDate *time.Time `json:"beatenDate,omitempty"` // время начала поездки, побившей рекорд
+}
+
+// record - рекорд одного вида с историей
+type record struct {
+	recordDef
+	History []recordEntry `json:"history"` // по времени установления, последний - действующий рекорд
+}
+
+// recordStore - хранилище рекордов: виды рекордов, лучшие результаты каждой поездки и история
+// рекордов. Результаты поездки считаются один раз и пересчитываются при других видах
+// рекордов или изменении длины поездки, история собирается заново по результатам поездок
+type recordStore struct {
+	Defs    []recordDef            `json:"defs"`
+	Rides   map[string]rideEfforts `json:"rides"`
+	Records []record               `json:"records"`
+}
+
+// sameDefs проверяет, что виды рекордов совпадают
+func sameDefs(a []recordDef, b []recordDef) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rideRecords возвращает лучшие результаты поездки t по видам рекордов defs
+func rideRecords(t *track.Track, defs []recordDef) []*track.Effort {
+	res := make([]*track.Effort, len(defs))
+	for i, d := range defs {
+		if e, ok := d.best(t); ok {
+			res[i] = &e
+		}
+	}
+	return res
+}
+
+// updateRecords пересчитывает рекорды поездок rides, считая результаты только новых и
+// измененных поездок, и записывает хранилище, если оно изменилось. Возвращает хранилище и
+// ключи поездок, результаты которых посчитаны
+func updateRecords(s *recordsSpec, rides []ride) (*recordStore, map[string]bool, error) {
+	defs := s.defs()
+	store := &recordStore{Defs: defs, Rides: make(map[string]rideEfforts)}
+	var prev recordStore
+	if data, err := os.ReadFile(s.Output); err == nil {
+		if err = json.Unmarshal(data, &prev); err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", s.Output, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	if !sameDefs(prev.Defs, defs) {
+		prev.Rides = nil
+	}
+	fresh := make(map[string]bool)
+	for _, r := range rides {
+		if r.track == nil || r.track.Len() < 2 {
+			continue
+		}
+		re, ok := prev.Rides[r.ID]
+		if !ok || math.Abs(re.Dist-r.Dist) > 1e-6 {
+			re = rideEfforts{Start: r.Start, Dist: r.Dist, Efforts: rideRecords(r.track, defs)}
+			fresh[r.ID] = true
+		}
+		re.Name = r.Name()
+		store.Rides[r.ID] = re
+	}
+	// история собирается по поездкам в порядке времени начала
+	for i, d := range defs {
+		rec := record{recordDef: d, History: []recordEntry{}}
+		for _, r := range rides {
+			re, ok := store.Rides[r.ID]
+			if !ok || re.Efforts[i] == nil {
+				continue
+			}
+			e := *re.Efforts[i]
+			if n := len(rec.History); n > 0 {
+				last := &rec.History[n-1]
+				if !d.better(e, last.Effort) {
+					continue
+				}
+				start := r.Start
+				last.Beaten, last.BeatenDate = r.ID, &start
+			}
+			rec.History = append(rec.History, recordEntry{Ride: r.ID, Name: re.Name, Date: re.Start, Effort: e})
+		}
+		store.Records = append(store.Records, rec)
+	}
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.Output), 0755); err != nil {
+		return nil, nil, err
+	}
+	return store, fresh, writeChanged(s.Output, append(data, '\n'))
+}
+
+// newRecords возвращает строки отчета о действующих и побитых рекордах, установленных
+// поездками fresh
+func newRecords(store *recordStore, fresh map[string]bool) []string {
+	var res []string
+	for _, rec := range store.Records {
+		for _, e := range rec.History {
+			if fresh[e.Ride] {
+				res = append(res, fmt.Sprintf("рекорд %s: %s, %s", rec.recordDef, rec.result(e.Effort), e.Name))
+			}
+		}
+	}
+	return res
+}
+
+// printRecords выводит таблицу истории рекордов: кто и когда установил каждый рекорд и когда
+// он был побит. Рекорды без результатов пропускаются
+func printRecords(w io.Writer, store *recordStore) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "рекорд\tрезультат\tпоездка\tдата\tпобит")
+	for _, rec := range store.Records {
+		for _, e := range rec.History {
+			beaten := "-"
+			if e.BeatenDate != nil {
+				beaten = e.BeatenDate.Local().Format("2006-01-02")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", rec.recordDef, rec.result(e.Effort), e.Name,
+				e.Date.Local().Format("2006-01-02"), beaten)
+		}
+	}
+	tw.Flush()
+}
+
+// printEfforts выводит таблицу лучших результатов одной поездки t по видам рекордов defs
+// со временем их начала от начала поездки
+func printEfforts(w io.Writer, t *track.Track, defs []recordDef) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "рекорд\tрезультат\tначало")
+	for i, e := range rideRecords(t, defs) {
+		if e != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", defs[i], defs[i].result(*e), time.Duration(math.Round(e.Start))*time.Second)
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gpx2js/track"
+)
+
+// recordRide возвращает поездку по треку вдоль меридиана, начатую на shift позже и
+// проходящую каждый из двух отрезков по 2,2 км за leg
+func recordRide(shift time.Duration, leg time.Duration) ride {
+	t := meridianTrack()
+	points := t.Segments[0].Points
+	for i := range points {
+		points[i].Time = points[0].Time.Add(shift + time.Duration(i)*leg)
+		if i > 0 {
+			points[i].Dist = track.Distance(points[i-1].Lat, points[i-1].Lon, points[i].Lat, points[i].Lon)
+		}
+	}
+	return ride{ID: t.Key(), Start: t.Start(), Stats: t.Stats(), track: t}
+}
+
+func Test_updateRecords(t *testing.T) {
+	spec := &recordsSpec{Output: filepath.Join(t.TempDir(), "records.json"), Dists: []float64{1}, Times: []float64{1}}
+	if err := spec.check(); err != nil {
+		t.Fatal(err)
+	}
+	a, b := recordRide(0, 4*time.Minute), recordRide(24*time.Hour, 2*time.Minute)
+	store, fresh, err := updateRecords(spec, []ride{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// мощности в треках нет, поэтому рекорд мощности без истории
+	if len(store.Records) != 3 || len(store.Records[0].History) != 1 || len(store.Records[2].History) != 0 || !fresh[a.ID] {
+		t.Fatalf("рекорды первой поездки %+v", store.Records)
+	}
+	if e := store.Records[0].History[0]; e.Ride != a.ID || e.Time < 100 || e.Time > 120 {
+		t.Errorf("рекорд 1 км %+v", e)
+	}
+	store, fresh, err = updateRecords(spec, []ride{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fresh) != 1 || !fresh[b.ID] {
+		t.Errorf("посчитаны поездки %v вместо второй", fresh)
+	}
+	for _, rec := range store.Records[:2] {
+		h := rec.History
+		if len(h) != 2 || h[0].Ride != a.ID || h[0].Beaten != b.ID || h[0].BeatenDate == nil ||
+			!h[0].BeatenDate.Equal(b.Start) || h[1].Ride != b.ID || h[1].Beaten != "" {
+			t.Errorf("история рекорда %s: %+v", rec.recordDef, h)
+		}
+	}
+	if lines := newRecords(store, fresh); len(lines) != 2 {
+		t.Errorf("отчет о новых рекордах %q", lines)
+	}
+	// другие дистанции - результаты всех поездок считаются заново
+	spec.Dists = []float64{2}
+	if _, fresh, err = updateRecords(spec, []ride{b}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fresh) != 1 || !fresh[b.ID] {
+		t.Errorf("посчитаны поездки %v при других дистанциях", fresh)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpx2js/track"
+)
+
+// templates - встроенные шаблоны страниц сайта
+//
+//go:embed templates
+var templates embed.FS
+
+// встроенные шаблоны страниц, которые используются, если у страницы в настройках не задан
+// свой шаблон
+const (
+	defaultTemplate = "templates/index.html.tmpl" // главная страница
+	rideTemplate    = "templates/ride.html.tmpl"  // страница поездки
+	yearTemplate    = "templates/year.html.tmpl"  // итоги года
+)
+
+// виды страниц: одна страница, страница на каждую поездку, страница на каждый год
+const (
+	eachNone = ""
+	eachRide = "ride"
+	eachYear = "year"
+)
+
+// pageSpec - страница сайта, собираемая по шаблону
+type pageSpec struct {
+	Template string `json:"template"` // шаблон html/template, пустой - встроенный шаблон вида страницы
+	Output   string `json:"output"`   // путь собранной страницы, для страниц поездок содержит {id}, для итогов года - {year}
+	Each     string `json:"each"`     // вид страницы: пусто - одна страница, ride - на каждую поездку, year - на каждый год
+}
+
+// templateName возвращает путь шаблона страницы или встроенного шаблона
+func (page pageSpec) templateName() string {
+	switch {
+	case page.Template != "":
+		return page.Template
+	case page.Each == eachRide:
+		return rideTemplate
+	case page.Each == eachYear:
+		return yearTemplate
+	}
+	return defaultTemplate
+}
+
+// output возвращает путь страницы поездки r или итогов года year
+func (page pageSpec) output(r *ride, year int) string {
+	id := ""
+	if r != nil {
+		id = r.ID
+	}
+	return strings.NewReplacer("{id}", id, "{year}", strconv.Itoa(year)).Replace(page.Output)
+}
+
+// check проверяет вид страницы, путь и шаблон страницы
+func (page pageSpec) check() error {
+	if page.Output == "" {
+		return fmt.Errorf("не указан путь страницы с шаблоном '%s'", page.templateName())
+	}
+	hasID, hasYear := strings.Contains(page.Output, "{id}"), strings.Contains(page.Output, "{year}")
+	switch page.Each {
+	case eachNone:
+		if hasID || hasYear {
+			return fmt.Errorf("путь одной страницы '%s' не может содержать {id} и {year}", page.Output)
+		}
+		if err := checkDir(filepath.Dir(page.Output), "выходной"); err != nil {
+			return err
+		}
+	case eachRide:
+		if !hasID {
+			return fmt.Errorf("путь страниц поездок '%s' должен содержать {id}", page.Output)
+		}
+	case eachYear:
+		if !hasYear {
+			return fmt.Errorf("путь страниц итогов года '%s' должен содержать {year}", page.Output)
+		}
+	default:
+		return fmt.Errorf("неизвестный вид страниц '%s', допустимы: %s, %s", page.Each, eachRide, eachYear)
+	}
+	_, err := parseTemplate(page)
+	return err
+}
+
+// ride - поездка из каталога json-данных поездок
+type ride struct {
+	ID          string    // ключ поездки
+	File        string    // путь файла json-данных поездки
+	Title       string    // название трека, может быть пустым
+	Start       time.Time // время начала поездки
+	track.Stats           // итоги поездки
+	Thumb       string    // путь svg-миниатюры поездки, если миниатюры заданы в настройках
+	Image       string    // путь миниатюры поездки в формате PNG, если она записывается
+	Map         string    // путь карты поездки в формате PNG, если карты заданы в настройках
+
+	track *track.Track // трек поездки
+}
+
+// Name возвращает название поездки или дату и время ее начала, если названия нет
+func (r ride) Name() string {
+	if r.Title != "" {
+		return r.Title
+	}
+	return r.Start.Local().Format("02.01.2006 15:04")
+}
+
+// yearTotals - итоги поездок за год
+type yearTotals struct {
+	Year   int     // год
+	Rides  int     // количество поездок
+	Dist   float64 // расстояние в метрах
+	Moving float64 // время движения в секундах
+	Gain   float64 // набор высоты в метрах
+}
+
+// add добавляет в итоги поездку r
+func (y *yearTotals) add(r ride) {
+	y.Rides++
+	y.Dist += r.Dist
+	y.Moving += r.Moving
+	y.Gain += r.Gain
+}
+
+// pageData - данные, доступные шаблону страницы
+type pageData struct {
+	Rides     []ride            // поездки в порядке времени начала, на странице итогов года - только поездки года
+	Years     []yearTotals      // итоги по годам от последнего к первому
+	Total     yearTotals        // итоги всех поездок, год не заполнен
+	Manifest  string            // путь манифеста относительно страницы, если он задан в настройках
+	Heatmap   *tileLayer        // слой теплокарты с адресом тайлов относительно страницы, если она задана в настройках
+	Vector    *tileLayer        // слой векторных тайлов всех поездок, если они заданы в настройках
+	Explorer  []explorerLayer   // слои исследованных тайлов, если они заданы в настройках
+	Scripts   []string          // пути js-файлов поездок относительно страницы, если манифеста нет или это страница поездки
+	Root      string            // путь корня сайта относительно страницы
+	URL       string            // адрес страницы, если в настройках задан адрес сайта
+	Ride      *ride             // поездка страницы поездки
+	Prev      *ride             // предыдущая поездка страницы поездки
+	Next      *ride             // следующая поездка страницы поездки
+	Year      *yearTotals       // итоги года страницы итогов года
+	Charts    []template.HTML   // svg-графики профиля поездки страницы поездки
+	Image     string            // адрес карты или PNG-миниатюры поездки для OpenGraph, если задан адрес сайта
+	MapImage  string            // ссылка на карту поездки страницы поездки, если карты заданы в настройках
+	Thumbs    map[string]string // ссылки на svg-миниатюры поездок по ключам поездок
+	RideLinks map[string]string // ссылки на страницы поездок по ключам поездок
+	YearLinks map[int]string    // ссылки на страницы итогов по годам
+}
+
+// templateFuncs - функции форматирования, доступные шаблонам страниц
+var templateFuncs = template.FuncMap{
+	"km": func(m float64) string {
+		return formatNumber(m/1000, 1)
+	},
+	"speed": func(kmh float64) string {
+		return formatNumber(kmh, 1)
+	},
+	"duration": func(sec float64) string {
+		d := time.Duration(sec) * time.Second
+		return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	},
+	"date": func(t time.Time) string {
+		return t.Local().Format("02.01.2006")
+	},
+}
+
+// loadRides читает все поездки каталога dest
+func loadRides(dest string) ([]ride, error) {
+	files, err := routeFiles(dest)
+	if err != nil {
+		return nil, err
+	}
+	rides := make([]ride, 0, len(files))
+	for _, file := range files {
+		t, _, err := decodeFile(file, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Error())
+		}
+		rides = append(rides, ride{ID: t.Key(), File: file, Title: t.Name, Start: t.Start(), Stats: t.Stats(), track: t})
+	}
+	sort.SliceStable(rides, func(i, j int) bool { return rides[i].Start.Before(rides[j].Start) })
+	return rides, nil
+}
+
+// site - данные для сборки всех страниц сайта
+type site struct {
+	cfg   *config
+	root  string       // корень сайта - каталог файла настроек
+	rides []ride       // поездки в порядке времени начала
+	years []yearTotals // итоги по годам от последнего к первому
+	total yearTotals   // итоги всех поездок
+}
+
+// newSite возвращает данные сайта с поездками rides
+func newSite(cfg *config, rides []ride) *site {
+	s := &site{cfg: cfg, root: ".", rides: rides}
+	if cfg.path != "" {
+		s.root = filepath.Dir(cfg.path)
+	}
+	for i := len(rides) - 1; i >= 0; i-- {
+		r := rides[i]
+		year := r.Start.Local().Year()
+		if len(s.years) == 0 || s.years[len(s.years)-1].Year != year {
+			s.years = append(s.years, yearTotals{Year: year})
+		}
+		s.years[len(s.years)-1].add(r)
+		s.total.add(r)
+	}
+	return s
+}
+
+// rel возвращает путь target относительно каталога страницы page в виде ссылки
+func rel(page string, target string) (string, error) {
+	p, err := relPath(filepath.Dir(page), target)
+	return filepath.ToSlash(p), err
+}
+
+// url возвращает адрес файла сайта или пустую строку, если адрес сайта не задан в настройках
+func (s *site) url(file string) (string, error) {
+	if s.cfg.URL == "" {
+		return "", nil
+	}
+	p, err := relPath(s.root, file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(s.cfg.URL, "/") + "/" + filepath.ToSlash(p), nil
+}
+
+// pageData возвращает данные шаблона страницы с путем out
+func (s *site) pageData(out string) (*pageData, error) {
+	data := &pageData{Rides: s.rides, Years: s.years, Total: s.total, RideLinks: make(map[string]string), YearLinks: make(map[int]string), Thumbs: make(map[string]string)}
+	var err error
+	if data.Root, err = rel(out, s.root); err != nil {
+		return nil, err
+	}
+	if data.URL, err = s.url(out); err != nil {
+		return nil, err
+	}
+	for _, r := range s.rides {
+		if r.Thumb != "" {
+			if data.Thumbs[r.ID], err = rel(out, r.Thumb); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.cfg.Heatmap != nil {
+		if data.Heatmap, err = heatmapTiles(s.cfg.Heatmap, filepath.Dir(out)); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.Vector != nil {
+		if data.Vector, err = vectorTiles(s.cfg.Vector, filepath.Dir(out)); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.Explorer != nil {
+		if data.Explorer, err = explorerLayers(s.cfg.Explorer, filepath.Dir(out)); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.Manifest != "" {
+		if data.Manifest, err = rel(out, s.cfg.Manifest); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, r := range s.rides {
+			script, err := rel(out, r.File)
+			if err != nil {
+				return nil, err
+			}
+			data.Scripts = append(data.Scripts, script)
+		}
+	}
+	for _, page := range s.cfg.Pages {
+		switch page.Each {
+		case eachRide:
+			for i := range s.rides {
+				if data.RideLinks[s.rides[i].ID], err = rel(out, page.output(&s.rides[i], 0)); err != nil {
+					return nil, err
+				}
+			}
+		case eachYear:
+			for _, y := range s.years {
+				if data.YearLinks[y.Year], err = rel(out, page.output(nil, y.Year)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// parseTemplate читает шаблон страницы page
+func parseTemplate(page pageSpec) (*template.Template, error) {
+	name := page.templateName()
+	t := template.New(filepath.Base(name)).Funcs(templateFuncs)
+	if page.Template == "" {
+		return t.ParseFS(templates, name)
+	}
+	return t.ParseFiles(name)
+}
+
+// renderPage возвращает страницу, собранную по шаблону t с данными data
+func renderPage(t *template.Template, data *pageData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pages возвращает содержимое всех страниц page по их путям
+func (s *site) pages(page pageSpec) (map[string][]byte, error) {
+	t, err := parseTemplate(page)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]byte)
+	render := func(out string, fill func(data *pageData) error) error {
+		data, err := s.pageData(out)
+		if err == nil {
+			err = fill(data)
+		}
+		if err == nil {
+			res[out], err = renderPage(t, data)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", out, err.Error())
+		}
+		return nil
+	}
+	switch page.Each {
+	case eachNone:
+		err = render(page.Output, func(*pageData) error { return nil })
+	case eachRide:
+		for i := range s.rides {
+			r := &s.rides[i]
+			err = render(page.output(r, 0), func(data *pageData) error {
+				data.Ride = r
+				if i > 0 {
+					data.Prev = &s.rides[i-1]
+				}
+				if i+1 < len(s.rides) {
+					data.Next = &s.rides[i+1]
+				}
+				for _, svg := range rideCharts(r.track) {
+					data.Charts = append(data.Charts, template.HTML(svg))
+				}
+				image := r.Map
+				if image == "" {
+					image = r.Image
+				}
+				if image != "" {
+					var err error
+					if data.Image, err = s.url(image); err != nil {
+						return err
+					}
+				}
+				if r.Map != "" {
+					var err error
+					if data.MapImage, err = rel(page.output(r, 0), r.Map); err != nil {
+						return err
+					}
+				}
+				script, err := rel(page.output(r, 0), r.File)
+				data.Scripts = []string{script}
+				return err
+			})
+			if err != nil {
+				break
+			}
+		}
+	case eachYear:
+		for i := range s.years {
+			y := &s.years[i]
+			err = render(page.output(nil, y.Year), func(data *pageData) error {
+				data.Year = y
+				data.Rides = nil
+				for _, r := range s.rides {
+					if r.Start.Local().Year() == y.Year {
+						data.Rides = append(data.Rides, r)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				break
+			}
+		}
+	}
+	return res, err
+}
+
+// writePages собирает все страницы настроек по шаблонам с поездками rides
+func writePages(cfg *config, rides []ride) error {
+	s := newSite(cfg, rides)
+	for _, page := range cfg.Pages {
+		pages, err := s.pages(page)
+		if err != nil {
+			return err
+		}
+		for out, data := range pages {
+			if err = os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+				return err
+			}
+			if err = writeFileAtomic(out, data, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic записывает файл через временный файл в том же каталоге, который затем
+// переименовывается, поэтому читатели файла никогда не видят его записанным частично
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
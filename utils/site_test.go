@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_updateHtmlsPages(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "routes")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gpx := filepath.Join(dir, "ride.gpx")
+	if err := os.WriteFile(gpx, testGpx(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := filepath.Join(dir, "list.html.tmpl")
+	list := `{{range .Rides}}{{.ID}} {{km .Dist}} км {{speed .AvgSpeed}} км/ч {{duration .Moving}} {{.Title}}
+{{end}}{{range .Years}}{{.Year}}: {{.Rides}}
+{{end}}`
+	if err := os.WriteFile(tmpl, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	cfg.Output = dest
+	cfg.Pages = []pageSpec{{Output: filepath.Join(dir, "index.html")}, {Template: tmpl, Output: filepath.Join(dir, "list.txt")}}
+	for _, page := range cfg.Pages {
+		if err := page.check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := convertFile(gpx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateHtmls(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "list.txt"))
+	if want := "1622728859 17,6 км 24,1 км/ч 0:42 2021-06-03T14:00:59Z\n2021: 1\n"; string(data) != want {
+		t.Errorf("неверная страница:\n%s", data)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "index.html"))
+	if !strings.Contains(string(data), `<script src="routes/1622728859.js"></script>`) {
+		t.Errorf("нет ссылки на json-данные поездки:\n%s", data)
+	}
+	cfg.Manifest = filepath.Join(dest, "index.json")
+	if err := updateHtmls(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "index.html"))
+	if !strings.Contains(string(data), `<script>var routesManifest = "routes/index.json"</script>`) {
+		t.Errorf("нет ссылки на манифест:\n%s", data)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, ".*")); len(files) > 0 {
+		t.Errorf("остались временные файлы: %v", files)
+	}
+	// страница не в корне сайта ссылается на стили и скрипты корня
+	cfg.path = filepath.Join(dir, configName)
+	cfg.Pages = []pageSpec{{Output: filepath.Join(dir, "sub", "index.html")}}
+	if err := updateHtmls(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "sub", "index.html"))
+	if !strings.Contains(string(data), `<link rel="stylesheet" href="../css/leaflet.css">`) ||
+		!strings.Contains(string(data), `<script src="../js/cycling-gpx.js"></script>`) {
+		t.Errorf("неверные ссылки на стили и скрипты:\n%s", data)
+	}
+}
+
+func Test_readHtmlBlockErrors(t *testing.T) {
+	for _, page := range []string{
+		"<head>\n</head>\n",
+		"<!-- begin of routers -->\n",
+		"<!-- end of routers -->\n<!-- begin of routers -->\n",
+		"<!-- begin of routers --><!-- end of routers -->\n",
+		"<!-- begin of routers -->\n<!-- begin of routers -->\n<!-- end of routers -->\n",
+		"<!-- begin of routers -->\n<!-- end of routers -->\n<!-- end of routers -->\n",
+	} {
+		html := filepath.Join(t.TempDir(), "index.html")
+		if err := os.WriteFile(html, []byte(page), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := readHtmlBlock(html); err == nil {
+			t.Errorf("нет ошибки разметки в %q", page)
+		}
+	}
+}
+
+func Test_writePagesEach(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "routes")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gpx := filepath.Join(dir, "ride.gpx")
+	if err := os.WriteFile(gpx, testGpx(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	cfg.Output = dest
+	cfg.path = filepath.Join(dir, configName)
+	cfg.URL = "https://example.com/site/"
+	cfg.Pages = []pageSpec{
+		{Output: filepath.Join(dir, "rides", "{id}.html"), Each: eachRide},
+		{Output: filepath.Join(dir, "years", "{year}.html"), Each: eachYear},
+	}
+	for _, page := range cfg.Pages {
+		if err := page.check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (pageSpec{Output: filepath.Join(dir, "rides.html"), Each: eachRide}).check(); err == nil {
+		t.Error("нет ошибки пути страниц поездок без {id}")
+	}
+	if _, err := convertFile(gpx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateHtmls(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "rides", "1622728859.html"))
+	for _, want := range []string{
+		`<meta property="og:url" content="https://example.com/site/rides/1622728859.html">`,
+		`<meta property="og:description" content="03.06.2021: 17,6 км, в движении 0:42, 24,1 км/ч">`,
+		`<script src="../routes/1622728859.js"></script>`,
+		`<a href="../years/2021.html">2021 год</a>`,
+		`const track = tracks["1622728859"]`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("на странице поездки нет %s:\n%s", want, data)
+		}
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "years", "2021.html"))
+	for _, want := range []string{
+		`<p>Поездок 1, 17,6 км, в движении 0:42</p>`,
+		`<a href="../rides/1622728859.html">2021-06-03T14:00:59Z</a>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("на странице итогов года нет %s:\n%s", want, data)
+		}
+	}
+}
+
+func Test_yearPageThumbs(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newConfig()
+	cfg.path = filepath.Join(dir, configName)
+	a, b := testRide(0), testRide(time.Hour)
+	a.File, b.File = filepath.Join(dir, "routes", a.ID+".js"), filepath.Join(dir, "routes", b.ID+".js")
+	// миниатюра есть только у одной поездки - ячейки второй не сдвигаются
+	a.Thumb = filepath.Join(dir, "thumbs", a.ID+".svg")
+	page := pageSpec{Output: filepath.Join(dir, "years", "{year}.html"), Each: eachYear}
+	pages, err := newSite(cfg, []ride{a, b}).pages(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range pages {
+		rows := strings.Split(string(data), "<tr>")[1:]
+		if len(rows) != 3 {
+			t.Fatalf("строк таблицы %d вместо 3:\n%s", len(rows), data)
+		}
+		for _, row := range rows {
+			if n := strings.Count(row, "<th") + strings.Count(row, "<td"); n != 6 {
+				t.Errorf("ячеек в строке %d вместо 6: %s", n, row)
+			}
+		}
+		if !strings.Contains(rows[2], "<td></td>") && !strings.Contains(rows[1], "<td></td>") {
+			t.Errorf("нет пустой ячейки миниатюры:\n%s", data)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // тайлы карты бывают в формате JPEG
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gpx2js/track"
+)
+
+// tileSize - размер тайла карты в пикселах
+const tileSize = 256
+
+// значения по умолчанию настроек карт поездок: размер картинки для социальных сетей
+const (
+	defaultMapWidth   = 1200
+	defaultMapHeight  = 630
+	defaultMapMaxZoom = 17
+)
+
+// missingTileColor - цвет области карты, тайла которой нет в каталоге
+var missingTileColor = color.RGBA{0xee, 0xee, 0xee, 0xff}
+
+// mapSpec - настройки карт поездок: PNG-картинок с треком на тайлах карты из локального
+// каталога, которые собираются без доступа к сети. Файлы MBTiles не читаются, так как это
+// базы SQLite, а утилита обходится стандартной библиотекой Go: их тайлы сначала выгружаются
+// в каталог, например, утилитой mb-util
+type mapSpec struct {
+	Tiles   string `json:"tiles"`   // каталог тайлов {z}/{x}/{y}.png или шаблон пути тайла с {z}, {x} и {y}
+	Output  string `json:"output"`  // каталог карт, файлы называются по ключам поездок
+	Width   int    `json:"width"`   // ширина карты в пикселах
+	Height  int    `json:"height"`  // высота карты в пикселах
+	MaxZoom int    `json:"maxZoom"` // наибольший масштаб тайлов
+}
+
+// setDefaults заполняет незаданные размеры и масштаб значениями по умолчанию
+func (s *mapSpec) setDefaults() {
+	if s.Width == 0 {
+		s.Width = defaultMapWidth
+	}
+	if s.Height == 0 {
+		s.Height = defaultMapHeight
+	}
+	if s.MaxZoom == 0 {
+		s.MaxZoom = defaultMapMaxZoom
+	}
+}
+
+// check проверяет каталог тайлов, размеры и масштаб карт. Каталога карт может еще не быть.
+// Для файла MBTiles вместо каталога возвращается ошибка с подсказкой, как его выгрузить
+func (s *mapSpec) check() error {
+	if strings.EqualFold(filepath.Ext(s.Tiles), ".mbtiles") {
+		return fmt.Errorf("файлы MBTiles '%s' не поддерживаются: для них нужна библиотека SQLite, "+
+			"выгрузите тайлы в каталог {z}/{x}/{y}.png, например, утилитой mb-util", s.Tiles)
+	}
+	if err := checkDir(s.tileRoot(), "входной"); err != nil {
+		return err
+	}
+	if s.Width < 64 || s.Width > 4096 || s.Height < 64 || s.Height > 4096 {
+		return fmt.Errorf("размер карт %dx%d вне диапазона 64..4096", s.Width, s.Height)
+	}
+	if s.MaxZoom < 0 || s.MaxZoom > 22 {
+		return fmt.Errorf("масштаб тайлов %d вне диапазона 0..22", s.MaxZoom)
+	}
+	if s.Output == "" {
+		return errors.New("не указан каталог карт")
+	}
+	if fi, err := os.Stat(s.Output); err == nil && !fi.IsDir() {
+		return fmt.Errorf("выходной каталог '%s' не является каталогом", s.Output)
+	}
+	return nil
+}
+
+// tileRoot возвращает каталог тайлов без шаблона пути
+func (s *mapSpec) tileRoot() string {
+	if i := strings.Index(s.Tiles, "{"); i >= 0 {
+		return filepath.Dir(s.Tiles[:i] + "x")
+	}
+	return s.Tiles
+}
+
+// tiles - тайлы карты из локального каталога с кэшем прочитанных тайлов
+type tiles struct {
+	pattern string                 // шаблон пути тайла
+	cache   map[string]image.Image // прочитанные тайлы по путям, nil - тайла нет
+}
+
+// maxCachedTiles - наибольшее количество тайлов в кэше
+const maxCachedTiles = 256
+
+// newTiles возвращает тайлы каталога или шаблона пути dir
+func newTiles(dir string) *tiles {
+	pattern := dir
+	if !strings.Contains(dir, "{z}") {
+		pattern = filepath.Join(dir, "{z}", "{x}", "{y}.png")
+	}
+	return &tiles{pattern: pattern, cache: make(map[string]image.Image)}
+}
+
+// tile возвращает тайл z/x/y или nil, если его нет. Вместо отсутствующего PNG-файла
+// ищется JPEG-файл с тем же именем
+func (ts *tiles) tile(z int, x int, y int) (image.Image, error) {
+	file := strings.NewReplacer("{z}", strconv.Itoa(z), "{x}", strconv.Itoa(x), "{y}", strconv.Itoa(y)).Replace(ts.pattern)
+	if img, ok := ts.cache[file]; ok {
+		return img, nil
+	}
+	if len(ts.cache) >= maxCachedTiles {
+		ts.cache = make(map[string]image.Image)
+	}
+	var img image.Image
+	for _, f := range []string{file, strings.TrimSuffix(file, ".png") + ".jpg"} {
+		r, err := os.Open(f)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		img, _, err = image.Decode(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f, err.Error())
+		}
+		break
+	}
+	ts.cache[file] = img
+	return img, nil
+}
+
+// fitZoom возвращает наибольший масштаб не больше maxZoom, при котором точки в проекции
+// Web Mercator помещаются в картинку width на height с отступами pad
+func fitZoom(points [][2]float64, width int, height int, pad int, maxZoom int) int {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		minX, minY = math.Min(minX, p[0]), math.Min(minY, p[1])
+		maxX, maxY = math.Max(maxX, p[0]), math.Max(maxY, p[1])
+	}
+	for z := maxZoom; z > 0; z-- {
+		world := float64(tileSize) * math.Exp2(float64(z))
+		if (maxX-minX)*world <= float64(width-2*pad) && (maxY-minY)*world <= float64(height-2*pad) {
+			return z
+		}
+	}
+	return 0
+}
+
+// renderMap возвращает карту трека t размером s.Width на s.Height в формате PNG и
+// количество тайлов, которых нет в каталоге
+func renderMap(t *track.Track, s *mapSpec, ts *tiles) ([]byte, int, error) {
+	points := t.Points()
+	merc := make([][2]float64, len(points))
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i, p := range points {
+		x, y := track.Mercator(p.Lat, p.Lon)
+		merc[i] = [2]float64{x, y}
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	z := fitZoom(merc, s.Width, s.Height, 20, s.MaxZoom)
+	world := float64(tileSize) * math.Exp2(float64(z))
+	// левый верхний угол карты в пикселах карты мира
+	left := (minX+maxX)/2*world - float64(s.Width)/2
+	top := (minY+maxY)/2*world - float64(s.Height)/2
+	c := newCanvas(s.Width, s.Height)
+	n := 1 << uint(z)
+	var missing int
+	for ty := int(math.Floor(top / tileSize)); float64(ty*tileSize) < top+float64(s.Height); ty++ {
+		for tx := int(math.Floor(left / tileSize)); float64(tx*tileSize) < left+float64(s.Width); tx++ {
+			dst := image.Rect(0, 0, tileSize, tileSize).Add(image.Pt(tx*tileSize-int(math.Floor(left)), ty*tileSize-int(math.Floor(top))))
+			var img image.Image
+			if ty >= 0 && ty < n {
+				var err error
+				if img, err = ts.tile(z, ((tx%n)+n)%n, ty); err != nil {
+					return nil, 0, err
+				}
+			}
+			if img == nil {
+				missing++
+				draw.Draw(c, dst, image.NewUniform(missingTileColor), image.Point{}, draw.Src)
+			} else {
+				draw.Draw(c, dst, img, img.Bounds().Min, draw.Src)
+			}
+		}
+	}
+	px := func(p [2]float64) (float64, float64) {
+		return p[0]*world - math.Floor(left), p[1]*world - math.Floor(top)
+	}
+	// оформление трека TRACK_STYLE страницы сайта: цвет #e600aa, толщина 4
+	for i := 1; i < len(merc); i++ {
+		x0, y0 := px(merc[i-1])
+		x1, y1 := px(merc[i])
+		c.line(x0, y0, x1, y1, 4, trackColor)
+	}
+	x, y := px(merc[0])
+	c.disk(x, y, 6, startColor)
+	x, y = px(merc[len(merc)-1])
+	c.disk(x, y, 6, finishColor)
+	var b bytes.Buffer
+	if err := png.Encode(&b, c); err != nil {
+		return nil, 0, err
+	}
+	return b.Bytes(), missing, nil
+}
+
+// writeMaps записывает карты поездок rides, которых нет или которые старше файлов
+// json-данных поездок или файла настроек cfgPath, и запоминает их пути в поездках
+func writeMaps(s *mapSpec, rides []ride, cfgPath string) error {
+	if err := os.MkdirAll(s.Output, 0755); err != nil {
+		return err
+	}
+	ts := newTiles(s.Tiles)
+	for i := range rides {
+		r := &rides[i]
+		out := filepath.Join(s.Output, r.ID+".png")
+		if upToDate(out, r.File, cfgPath) {
+			r.Map = out
+			continue
+		}
+		data, missing, err := renderMap(r.track, s, ts)
+		if err != nil {
+			return fmt.Errorf("%s: %s", r.File, err.Error())
+		}
+		if missing > 0 {
+			fmt.Printf("%s: нет тайлов карты: %d\n", out, missing)
+		}
+		if err = writeFileAtomic(out, data, 0644); err != nil {
+			return err
+		}
+		r.Map = out
+	}
+	return nil
+}
+
+// upToDate проверяет, что файл out есть и изменен не раньше файлов srcs. Пустые пути
+// пропускаются
+func upToDate(out string, srcs ...string) bool {
+	o, err := os.Stat(out)
+	if err != nil {
+		return false
+	}
+	for _, src := range srcs {
+		if src == "" {
+			continue
+		}
+		if i, err := os.Stat(src); err != nil || o.ModTime().Before(i.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
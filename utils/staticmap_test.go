@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gpx2js/track"
+)
+
+func Test_renderMap(t *testing.T) {
+	dir := t.TempDir()
+	spec := &mapSpec{Tiles: dir, Output: dir, Width: 300, Height: 200}
+	spec.setDefaults()
+	if err := spec.check(); err != nil {
+		t.Fatal(err)
+	}
+	trk := meridianTrack()
+	var merc [][2]float64
+	for _, p := range trk.Points() {
+		x, y := track.Mercator(p.Lat, p.Lon)
+		merc = append(merc, [2]float64{x, y})
+	}
+	z := fitZoom(merc, spec.Width, spec.Height, 20, spec.MaxZoom)
+	if span := (merc[2][1] - merc[0][1]) * tileSize * math.Exp2(float64(z)); span > 160 || span < 80 {
+		t.Errorf("масштаб %d: трек высотой %.0f пикселов", z, span)
+	}
+	// синие тайлы вокруг трека, кроме тайлов левее него
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	tile := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+	for i := range tile.Pix {
+		tile.Pix[i] = []byte{blue.R, blue.G, blue.B, blue.A}[i%4]
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, tile); err != nil {
+		t.Fatal(err)
+	}
+	n := math.Exp2(float64(z))
+	cx, cy := int(merc[1][0]*n), int(merc[1][1]*n)
+	for x := cx; x <= cx+2; x++ {
+		for y := cy - 2; y <= cy+2; y++ {
+			file := filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(y)+".png")
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, b.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	data, missing, err := renderMap(trk, spec, newTiles(spec.Tiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 300 || img.Bounds().Dy() != 200 {
+		t.Errorf("размер карты %v", img.Bounds())
+	}
+	if got := color.RGBAModel.Convert(img.At(150, 100)); got != trackColor {
+		t.Errorf("в центре карты %v вместо цвета трека", got)
+	}
+	right := color.RGBAModel.Convert(img.At(299, 100))
+	left := color.RGBAModel.Convert(img.At(0, 100))
+	if right != blue || (left != missingTileColor && left != blue) {
+		t.Errorf("по краям карты %v и %v", left, right)
+	}
+	if missing == 0 && left == missingTileColor {
+		t.Error("не посчитаны отсутствующие тайлы")
+	}
+}
+
+func Test_mapSpecMBTiles(t *testing.T) {
+	spec := &mapSpec{Tiles: "osm.mbtiles", Output: "."}
+	spec.setDefaults()
+	if err := spec.check(); err == nil {
+		t.Error("нет ошибки для файла MBTiles")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+
+	"gpx2js/track"
+)
+
+// оформление миниатюры поездки
+var (
+	startColor  = color.RGBA{0x00, 0xa0, 0x00, 0xff} // точка начала поездки
+	finishColor = color.RGBA{0xd0, 0x00, 0x00, 0xff} // точка окончания поездки
+)
+
+// defaultThumbSize - размер миниатюры поездки по умолчанию в пикселах
+const defaultThumbSize = 120
+
+// thumbSpec - настройки миниатюр поездок: силуэтов треков в проекции Web Mercator
+type thumbSpec struct {
+	Output string `json:"output"` // каталог миниатюр, файлы называются по ключам поездок
+	Size   int    `json:"size"`   // размер квадратной миниатюры в пикселах
+	PNG    bool   `json:"png"`    // кроме svg записывать миниатюры в формате PNG
+}
+
+// check проверяет каталог и размер миниатюр. Каталога может еще не быть
+func (s *thumbSpec) check() error {
+	if s.Size < 16 || s.Size > 1024 {
+		return fmt.Errorf("размер миниатюр %d вне диапазона 16..1024", s.Size)
+	}
+	if s.Output == "" {
+		return errors.New("не указан каталог миниатюр")
+	}
+	if fi, err := os.Stat(s.Output); err == nil && !fi.IsDir() {
+		return fmt.Errorf("выходной каталог '%s' не является каталогом", s.Output)
+	}
+	return nil
+}
+
+// path возвращает путь миниатюры поездки id с расширением ext
+func (s *thumbSpec) path(id string, ext string) string {
+	return filepath.Join(s.Output, id+ext)
+}
+
+// projection возвращает точки трека в пикселах миниатюры размером size: трек в проекции
+// Web Mercator вписывается в квадрат с отступами с сохранением пропорций и по центру
+func projection(points []track.Point, size int) [][2]float64 {
+	res := make([][2]float64, len(points))
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i, p := range points {
+		x, y := track.Mercator(p.Lat, p.Lon)
+		res[i] = [2]float64{x, y}
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	pad := math.Max(4, float64(size)/15) // отступ, в который помещаются точки начала и окончания
+	var scale float64
+	if span := math.Max(maxX-minX, maxY-minY); span > 0 {
+		scale = (float64(size) - 2*pad) / span
+	}
+	cx, cy := (minX+maxX)/2, (minY+maxY)/2
+	for i, p := range res {
+		res[i] = [2]float64{float64(size)/2 + (p[0]-cx)*scale, float64(size)/2 + (p[1]-cy)*scale}
+	}
+	return res
+}
+
+// lineWidth возвращает толщину линии трека на миниатюре размером size
+func lineWidth(size int) float64 {
+	return math.Max(1.5, float64(size)/60)
+}
+
+// thumbnailSVG возвращает svg-миниатюру трека размером size пикселов
+func thumbnailSVG(t *track.Track, size int) []byte {
+	points := projection(t.Points(), size)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, size, size, size, size)
+	fmt.Fprintf(&b, `<path fill="none" stroke="%s" stroke-width="%.1f" stroke-linecap="round" stroke-linejoin="round" d="`,
+		hexColor(trackColor), lineWidth(size))
+	var prev string
+	for i, p := range points {
+		xy := fmt.Sprintf("%.1f %.1f", p[0], p[1])
+		if i == 0 {
+			b.WriteString("M" + xy)
+		} else if xy != prev { // совпадающие в масштабе миниатюры точки пропускаются
+			b.WriteString("L" + xy)
+		}
+		prev = xy
+	}
+	b.WriteString(`"/>`)
+	r := 2 * lineWidth(size)
+	first, last := points[0], points[len(points)-1]
+	fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s" stroke="#fff"/>`, first[0], first[1], r, hexColor(startColor))
+	fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s" stroke="#fff"/>`, last[0], last[1], r, hexColor(finishColor))
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// thumbnailPNG возвращает миниатюру трека размером size пикселов в формате PNG
+func thumbnailPNG(t *track.Track, size int) ([]byte, error) {
+	points := projection(t.Points(), size)
+	c := newCanvas(size, size)
+	w := lineWidth(size)
+	for i := 1; i < len(points); i++ {
+		c.line(points[i-1][0], points[i-1][1], points[i][0], points[i][1], w, trackColor)
+	}
+	first, last := points[0], points[len(points)-1]
+	c.disk(first[0], first[1], 2*w, startColor)
+	c.disk(last[0], last[1], 2*w, finishColor)
+	var b bytes.Buffer
+	if err := png.Encode(&b, c); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeThumbnails записывает миниатюры поездок rides, которых нет или которые изменились,
+// и запоминает их пути в поездках
+func writeThumbnails(s *thumbSpec, rides []ride) error {
+	if err := os.MkdirAll(s.Output, 0755); err != nil {
+		return err
+	}
+	for i := range rides {
+		r := &rides[i]
+		if r.track == nil || r.track.Len() < 1 {
+			return errors.New(r.File + ": " + track.ErrEmpty.Error())
+		}
+		r.Thumb = s.path(r.ID, ".svg")
+		if err := writeChanged(r.Thumb, thumbnailSVG(r.track, s.Size)); err != nil {
+			return err
+		}
+		if !s.PNG {
+			continue
+		}
+		data, err := thumbnailPNG(r.track, s.Size)
+		if err != nil {
+			return err
+		}
+		r.Image = s.path(r.ID, ".png")
+		if err = writeChanged(r.Image, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChanged записывает файл, только если его нет или его содержимое отличается от data
+func writeChanged(file string, data []byte) error {
+	if prev, err := os.ReadFile(file); err == nil && bytes.Equal(prev, data) {
+		return nil
+	}
+	return writeFileAtomic(file, data, 0644)
+}
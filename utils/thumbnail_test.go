@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpx2js/track"
+)
+
+// meridianTrack возвращает трек на юг вдоль меридиана
+func meridianTrack() *track.Track {
+	t0 := time.Date(2021, 6, 3, 14, 0, 0, 0, time.UTC)
+	return track.FromPoints([]track.Point{
+		{Lat: 59.95, Lon: 30.3, Time: t0},
+		{Lat: 59.93, Lon: 30.3, Time: t0.Add(time.Minute)},
+		{Lat: 59.91, Lon: 30.3, Time: t0.Add(2 * time.Minute)},
+	})
+}
+
+func Example_thumbnailSVG() {
+	os.Stdout.Write(thumbnailSVG(meridianTrack(), 60))
+	// Output:
+	// <svg xmlns="http://www.w3.org/2000/svg" width="60" height="60" viewBox="0 0 60 60"><path fill="none" stroke="#e600aa" stroke-width="1.5" stroke-linecap="round" stroke-linejoin="round" d="M30.0 4.0L30.0 30.0L30.0 56.0"/><circle cx="30.0" cy="4.0" r="3.0" fill="#00a000" stroke="#fff"/><circle cx="30.0" cy="56.0" r="3.0" fill="#d00000" stroke="#fff"/></svg>
+}
+
+func Test_thumbnailPNG(t *testing.T) {
+	data, err := thumbnailPNG(meridianTrack(), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		x, y int
+		want string
+	}{
+		{30, 4, "start"}, {30, 55, "finish"}, {30, 30, "track"}, {10, 30, "none"},
+	} {
+		r, g, b, a := img.At(tc.x, tc.y).RGBA()
+		var got string
+		switch {
+		case a == 0:
+			got = "none"
+		case g > r && g > b:
+			got = "start"
+		case r > b && b == 0:
+			got = "finish"
+		default:
+			got = "track"
+		}
+		if got != tc.want {
+			t.Errorf("пиксел %d,%d: %s вместо %s", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func Test_updateHtmlsThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	gpx := filepath.Join(dir, "ride.gpx")
+	if err := os.WriteFile(gpx, testGpx(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	cfg.Output = dir
+	cfg.Manifest = filepath.Join(dir, "index.json")
+	cfg.Thumbnails = &thumbSpec{Output: dir, Size: defaultThumbSize, PNG: true}
+	if err := cfg.Thumbnails.check(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := convertFile(gpx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateHtmls(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(cfg.Manifest)
+	if !strings.Contains(string(data), `"thumb":"1622728859.svg"`) {
+		t.Errorf("нет миниатюры в манифесте:\n%s", data)
+	}
+	for _, file := range []string{"1622728859.svg", "1622728859.png"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Error(err)
+		}
+	}
+}
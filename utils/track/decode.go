@@ -0,0 +1,142 @@
+package track
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options - параметры фильтрации и сглаживания точек трека при чтении
+type Options struct {
+	MaxSpeed    float64 // максимальная адекватная скорость в м/с, 0 - без ограничения
+	SmoothCount int     // количество соседних точек назад и вперед для сглаживания, 0 - без сглаживания
+	SmoothTime  int     // интервал в секундах назад и вперед для сглаживания
+}
+
+// DefaultOptions - параметры для велопоездок
+var DefaultOptions = Options{MaxSpeed: 40, SmoothCount: 3, SmoothTime: 3}
+
+// Pipeline возвращает этапы обработки, соответствующие параметрам: удаление дублей,
+// удаление выбросов по скорости и сглаживание расстояний
+func (opts Options) Pipeline() Pipeline {
+	p := Pipeline{Dedupe{}}
+	if opts.MaxSpeed > 0 {
+		p = append(p, Outliers{MaxSpeed: opts.MaxSpeed})
+	}
+	if opts.SmoothCount > 0 {
+		p = append(p, Smooth{Count: opts.SmoothCount, Time: opts.SmoothTime})
+	}
+	return p
+}
+
+// gpxPoint - элемент trkpt GPX-файла
+type gpxPoint struct {
+	Lat  float64   `xml:"lat,attr"` //широта в градусах
+	Lon  float64   `xml:"lon,attr"` //долгота в градусах
+	Ele  *float64  `xml:"ele"`      //высота в метрах
+	Time time.Time `xml:"time"`     //Время UTC
+	Ext  *struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"extensions"` //расширения как есть
+}
+
+// Decode читает трек из GPX-данных и обрабатывает его этапами opts.Pipeline(). Точки
+// с неизменившимися координатами, с временем меньше, чем у предыдущей точки, и со
+// скоростью больше opts.MaxSpeed отбрасываются. Из точек с одинаковым временем
+// остается последняя. Расстояния между точками сглаживаются по соседним точкам
+// согласно opts.SmoothCount и opts.SmoothTime
+func Decode(r io.Reader, opts Options) (*Track, error) {
+	t, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = opts.Pipeline().Process(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Parse читает трек из GPX-данных без какой-либо обработки точек. Расстояния точек
+// отсчитываются по прямой от предыдущей точки. Точки маршрута wpt с типом lap и временем
+// считаются отметками начала кругов
+func Parse(r io.Reader) (*Track, error) {
+	t := &Track{}
+	var f flat
+	var seg int
+	var inTrk bool
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "gpx":
+				for _, attr := range tok.Attr {
+					if attr.Name.Space == "xmlns" {
+						if t.Namespaces == nil {
+							t.Namespaces = make(map[string]string)
+						}
+						t.Namespaces[attr.Name.Local] = attr.Value
+					}
+				}
+			case "trk":
+				inTrk = true
+			case "name":
+				if inTrk && t.Name == "" {
+					if err := d.DecodeElement(&t.Name, &tok); err != nil {
+						return nil, err
+					}
+				}
+			case "trkseg":
+				seg++
+			case "wpt":
+				// отметка круга - точка маршрута с типом lap и временем
+				var wpt struct {
+					Time *time.Time `xml:"time"`
+					Type string     `xml:"type"`
+				}
+				if err := d.DecodeElement(&wpt, &tok); err != nil {
+					return nil, err
+				}
+				if wpt.Time != nil && strings.EqualFold(strings.TrimSpace(wpt.Type), "lap") {
+					t.Laps = append(t.Laps, wpt.Time.UTC())
+				}
+			case "trkpt":
+				var gp gpxPoint
+				if err := d.DecodeElement(&gp, &tok); err != nil {
+					return nil, err
+				}
+				p := Point{Lat: gp.Lat, Lon: gp.Lon, Time: gp.Time}
+				if gp.Ele != nil {
+					p.Ele, p.HasEle = *gp.Ele, true
+				}
+				if gp.Ext != nil {
+					p.Ext = strings.TrimSpace(gp.Ext.Inner)
+				}
+				f.add(p, seg)
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "trk" {
+				inTrk = false
+			}
+		}
+	}
+	f.apply(t)
+	t.Total = t.Len()
+	t.resetDist()
+	sortLaps(t)
+	return t, nil
+}
+
+// sortLaps упорядочивает время начала кругов
+func sortLaps(t *Track) {
+	sort.Slice(t.Laps, func(i, j int) bool { return t.Laps[i].Before(t.Laps[j]) })
+}
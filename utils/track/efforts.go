@@ -0,0 +1,89 @@
+package track
+
+import "math"
+
+// Effort - лучший результат поездки: самое быстрое прохождение дистанции или наибольшая
+// средняя скорость или мощность за время. Время считается вместе с остановками
+type Effort struct {
+	Start float64 `json:"start"`           // время начала отрезка от начала поездки в секундах
+	Dist  float64 `json:"dist"`            // длина отрезка в метрах
+	Time  float64 `json:"time"`            // продолжительность отрезка в секундах
+	Speed float64 `json:"speed"`           // средняя скорость на отрезке в км/ч
+	Power float64 `json:"power,omitempty"` // средняя мощность на отрезке в ваттах, если она известна
+}
+
+// cursor интерполирует точки по неубывающим от вызова к вызову значениям величины key
+type cursor struct {
+	points []splitPoint
+	key    func(p splitPoint) float64
+	i      int
+}
+
+// at возвращает точку, в которой величина key равна x
+func (c *cursor) at(x float64) splitPoint {
+	for c.i+2 < len(c.points) && c.key(c.points[c.i+1]) <= x {
+		c.i++
+	}
+	a, b := c.points[c.i], c.points[c.i+1]
+	f := 1.0
+	if c.key(b) > c.key(a) {
+		f = math.Min(1, math.Max(0, (x-c.key(a))/(c.key(b)-c.key(a))))
+	}
+	return interpolate(a, b, f)
+}
+
+// best возвращает отрезок длины size по величине key с наибольшей оценкой score. Окно
+// скользит по точкам трека: при линейной интерполяции между точками у лучшего отрезка один
+// из концов лежит в точке трека, поэтому проверяются отрезки, которые в точках начинаются
+// или заканчиваются
+func best(points []splitPoint, key func(p splitPoint) float64, size float64, score func(a splitPoint, b splitPoint) float64) (Effort, bool) {
+	if len(points) < 2 || size <= 0 || key(points[len(points)-1])-key(points[0]) < size {
+		return Effort{}, false
+	}
+	var ba, bb splitPoint
+	max := math.Inf(-1)
+	try := func(a splitPoint, b splitPoint) {
+		if s := score(a, b); s > max {
+			max, ba, bb = s, a, b
+		}
+	}
+	first, last := key(points[0]), key(points[len(points)-1])
+	starts := &cursor{points: points, key: key}
+	ends := &cursor{points: points, key: key}
+	for _, p := range points {
+		if key(p)-size >= first {
+			try(starts.at(key(p)-size), p)
+		}
+		if key(p)+size <= last {
+			try(p, ends.at(key(p)+size))
+		}
+	}
+	e := Effort{Start: ba.time, Dist: bb.dist - ba.dist, Time: bb.time - ba.time}
+	if e.Time > 0 {
+		e.Speed = 3.6 * e.Dist / e.Time
+		e.Power = (bb.work - ba.work) / e.Time
+	}
+	return e, true
+}
+
+// BestDist возвращает самое быстрое прохождение dist метров поездки или false, если
+// поездка короче
+func (t *Track) BestDist(dist float64) (Effort, bool) {
+	return best(t.splitPoints(), byDist, dist, func(a splitPoint, b splitPoint) float64 { return a.time - b.time })
+}
+
+// BestSpeed возвращает отрезок поездки продолжительностью sec секунд с наибольшей средней
+// скоростью или false, если поездка короче
+func (t *Track) BestSpeed(sec float64) (Effort, bool) {
+	return best(t.splitPoints(), byTime, sec, func(a splitPoint, b splitPoint) float64 { return b.dist - a.dist })
+}
+
+// BestPower возвращает отрезок поездки продолжительностью sec секунд с наибольшей средней
+// мощностью или false, если поездка короче или мощность в треке неизвестна. Точки без
+// мощности считаются точками с нулевой мощностью
+func (t *Track) BestPower(sec float64) (Effort, bool) {
+	if !hasPower(t.Points()) {
+		return Effort{}, false
+	}
+	return best(t.splitPoints(), byTime, sec, func(a splitPoint, b splitPoint) float64 { return b.work - a.work })
+}
@@ -0,0 +1,62 @@
+package track
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEfforts(t *testing.T) {
+	// раз в секунду 20 с по 5 м со 100 Вт, 10 с по 10 м с 300 Вт и 20 с по 5 м со 100 Вт
+	t0 := time.Date(2021, 6, 3, 14, 0, 0, 0, time.UTC)
+	points := make([]Point, 51)
+	var dist float64
+	for i := range points {
+		step, pw := 5.0, 100
+		if i > 20 && i <= 30 {
+			step, pw = 10, 300
+		}
+		if i > 0 {
+			dist += step
+		}
+		points[i] = Point{Lat: 59.9 + dist/EarthRadius*180/math.Pi, Lon: 30.25, Time: t0.Add(time.Duration(i) * time.Second)}
+		if i > 0 {
+			points[i].Ext = powerExt(pw)
+		}
+	}
+	trk := FromPoints(points)
+	trk.resetDist()
+	near := func(a float64, b float64) bool { return math.Abs(a-b) < 1e-6 }
+	e, ok := trk.BestDist(100)
+	if !ok || !near(e.Start, 20) || !near(e.Time, 10) || !near(e.Speed, 36) || !near(e.Power, 300) {
+		t.Errorf("лучшие 100 м: %+v", e)
+	}
+	if e, ok = trk.BestDist(150); !ok || !near(e.Time, 20) || !near(e.Dist, 150) {
+		t.Errorf("лучшие 150 м: %+v", e)
+	}
+	if e, ok = trk.BestSpeed(20); !ok || !near(e.Dist, 150) || !near(e.Speed, 27) {
+		t.Errorf("лучшие 20 с: %+v", e)
+	}
+	if e, ok = trk.BestPower(5); !ok || !near(e.Power, 300) || !near(e.Speed, 36) {
+		t.Errorf("лучшая мощность за 5 с: %+v", e)
+	}
+	if _, ok = trk.BestDist(1000); ok {
+		t.Error("лучший километр поездки короче километра")
+	}
+	if _, ok = FromPoints(linePoints(10, 10)).BestPower(5); ok {
+		t.Error("лучшая мощность трека без мощности")
+	}
+	// мощность сохраняется в json-данных поездки
+	var b bytes.Buffer
+	if err := trk.Encode(&b, JSON); err != nil {
+		t.Fatal(err)
+	}
+	rt, err := DecodeRoute(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok = rt.BestPower(10); !ok || !near(e.Power, 300) {
+		t.Errorf("лучшая мощность прочитанного трека: %+v", e)
+	}
+}
@@ -0,0 +1,297 @@
+package track
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrEmpty - ошибка записи трека без точек
+var ErrEmpty = errors.New("в треке нет данных")
+
+// Precision - количество знаков после запятой в выходных данных
+type Precision struct {
+	LL int `json:"ll"` // координаты
+	DT int `json:"dt"` // интервалы времени
+	DD int `json:"dd"` // расстояния
+	EL int `json:"el"` // высоты
+}
+
+// DefaultPrecision - точность по умолчанию: координаты до 0,1 м, интервалы времени до
+// секунды, расстояния до сантиметра, высоты до дециметра
+var DefaultPrecision = Precision{LL: 6, DD: 2, EL: 1}
+
+// Format - формат записи трека
+type Format struct {
+	Name      string    // название формата из Formats
+	Precision Precision // точность чисел
+	Splits    float64   // длина отрезков разбивки поездки "splits" в json-данных в метрах, 0 - без разбивки
+}
+
+// JS - формат json-данных поездок сайта: tracks['<ключ>']={"ll":[[широта,долгота],...],
+// "dt":[интервалы времени от предыдущей точки в секундах],"dd":[расстояния от предыдущей точки в метрах],
+// "el":[высоты в метрах, если они есть в треке],"hr":[пульс в ударах в минуту, если он есть в треке],
+// "pw":[мощности в ваттах, если они есть в треке],
+// "name":"название, если оно есть",
+// "splits":[отрезки разбивки по Format.Splits метров, если она задана],"laps":[отрезки кругов,
+// если они есть в треке],"st":{итоги поездки}}
+var JS = Format{Name: "js", Precision: DefaultPrecision}
+
+// JSON - те же данные, что и в JS, в виде json-объекта без обертки с ключом поездки в поле "id"
+var JSON = Format{Name: "json", Precision: DefaultPrecision}
+
+// GeoJSON - объект Feature с линией LineString, координаты которой содержат и высоты, если
+// они есть в треке. Свойства содержат ключ и название поездки, время начала, массивы "dt",
+// "dd", "hr" и "pw", соответствующие координатам линии, и итоги поездки "st"
+var GeoJSON = Format{Name: "geojson", Precision: DefaultPrecision}
+
+// Formats - названия поддерживаемых форматов
+var Formats = []string{"js", "json", "geojson", "gpx", "kml", "csv"}
+
+// ParseFormat возвращает формат по его названию с точностью по умолчанию
+func ParseFormat(name string) (Format, error) {
+	for _, n := range Formats {
+		if n == name {
+			return Format{Name: name, Precision: DefaultPrecision}, nil
+		}
+	}
+	return Format{}, fmt.Errorf("неизвестный формат '%s', допустимы: %s", name, strings.Join(Formats, ", "))
+}
+
+// Ext возвращает расширение файла формата
+func (f Format) Ext() string {
+	return "." + f.Name
+}
+
+// Encode записывает трек в формате f
+func (t *Track) Encode(w io.Writer, f Format) error {
+	if t.Len() < 1 {
+		return ErrEmpty
+	}
+	if _, err := ParseFormat(f.Name); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	switch f.Name {
+	case "js":
+		encodeJS(bw, t, f)
+	case "json":
+		encodeJSON(bw, t, f)
+	case "geojson":
+		encodeGeoJSON(bw, t, f)
+	case "gpx":
+		encodeGPX(bw, t, f.Precision)
+	case "kml":
+		encodeKML(bw, t, f.Precision)
+	default:
+		encodeCSV(bw, t.Points(), f.Precision)
+	}
+	return bw.Flush()
+}
+
+// writeArray записывает массив name с элементами, которые выводит item для каждой точки
+func writeArray(w io.Writer, name string, points []Point, item func(Point)) {
+	fmt.Fprintf(w, "\"%s\":[", name)
+	for i := 0; i < len(points); i++ {
+		if i > 0 {
+			fmt.Fprint(w, ",")
+		}
+		item(points[i])
+	}
+	fmt.Fprint(w, "]")
+}
+
+// writeDT записывает массив интервалов времени от предыдущей точки в секундах
+func writeDT(w io.Writer, points []Point, prec Precision) {
+	var prev *Point
+	writeArray(w, "dt", points, func(p Point) {
+		var dt float64
+		if prev != nil {
+			dt = p.Time.Sub(prev.Time).Seconds()
+		}
+		prev = &p
+		fmt.Fprintf(w, "%.*f", prec.DT, dt)
+	})
+}
+
+// writeDD записывает массив расстояний от предыдущей точки в метрах
+func writeDD(w io.Writer, points []Point, prec Precision) {
+	writeArray(w, "dd", points, func(p Point) {
+		fmt.Fprintf(w, "%.*f", prec.DD, p.Dist)
+	})
+}
+
+// hasPower проверяет, что хотя бы у одной точки известна мощность
+func hasPower(points []Point) bool {
+	return hasInt(points, Point.Power)
+}
+
+// hasInt проверяет, что хотя бы у одной точки известно значение value
+func hasInt(points []Point, value func(Point) (int, bool)) bool {
+	for _, p := range points {
+		if _, ok := value(p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeInts записывает с запятой в конце массив name целых значений value точек, если
+// значение известно хотя бы у одной точки, неизвестные значения - null
+func writeInts(w io.Writer, name string, points []Point, value func(Point) (int, bool)) {
+	if !hasInt(points, value) {
+		return
+	}
+	writeArray(w, name, points, func(p Point) {
+		if v, ok := value(p); ok {
+			fmt.Fprintf(w, "%d", v)
+		} else {
+			fmt.Fprint(w, "null")
+		}
+	})
+	fmt.Fprint(w, ",")
+}
+
+// hasEle проверяет, что хотя бы у одной точки известна высота
+func hasEle(points []Point) bool {
+	for _, p := range points {
+		if p.HasEle {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFields записывает поля "ll", "dt", "dd", "el", "hr", "pw", "name", "splits", "laps" и "st" объекта поездки
+func writeFields(w io.Writer, t *Track, f Format) {
+	prec := f.Precision
+	points := t.Points()
+	// кординаты
+	writeArray(w, "ll", points, func(p Point) {
+		fmt.Fprintf(w, "[%.*f,%.*f]", prec.LL, p.Lat, prec.LL, p.Lon)
+	})
+	fmt.Fprint(w, ",")
+	// интервалы времени
+	writeDT(w, points, prec)
+	fmt.Fprint(w, ",")
+	// расстояния
+	writeDD(w, points, prec)
+	fmt.Fprint(w, ",")
+	// высоты, неизвестные высоты - null
+	if hasEle(points) {
+		writeArray(w, "el", points, func(p Point) {
+			if p.HasEle {
+				fmt.Fprintf(w, "%.*f", prec.EL, p.Ele)
+			} else {
+				fmt.Fprint(w, "null")
+			}
+		})
+		fmt.Fprint(w, ",")
+	}
+	// пульс и мощности
+	writeInts(w, "hr", points, Point.HeartRate)
+	writeInts(w, "pw", points, Point.Power)
+	// название
+	if t.Name != "" {
+		fmt.Fprintf(w, "\"name\":%s,", jsonString(t.Name))
+	}
+	writeBreakdown(w, t, f)
+	// итоги
+	writeStats(w, "st", rounded(t, prec).Stats(), prec)
+}
+
+// writeBreakdown записывает с запятой после каждого массива разбивку поездки по
+// Format.Splits метров, если она задана, и по кругам, если они есть в треке
+func writeBreakdown(w io.Writer, t *Track, f Format) {
+	if splits := t.Splits(f.Splits); len(splits) > 0 {
+		writeSplits(w, "splits", splits, f.Precision)
+		fmt.Fprint(w, ",")
+	}
+	if laps := t.LapSplits(); len(laps) > 0 {
+		writeSplits(w, "laps", laps, f.Precision)
+		fmt.Fprint(w, ",")
+	}
+}
+
+// encodeJS записывает трек в формате JS
+func encodeJS(w io.Writer, t *Track, f Format) {
+	fmt.Fprintf(w, "tracks['%s']={", t.Key())
+	writeFields(w, t, f)
+	fmt.Fprint(w, "}")
+}
+
+// encodeJSON записывает трек в формате JSON
+func encodeJSON(w io.Writer, t *Track, f Format) {
+	fmt.Fprintf(w, "{\"id\":%s,", jsonString(t.Key()))
+	writeFields(w, t, f)
+	fmt.Fprint(w, "}")
+}
+
+// encodeGeoJSON записывает трек в формате GeoJSON. Координаты в нем идут в порядке долгота, широта
+func encodeGeoJSON(w io.Writer, t *Track, f Format) {
+	prec := f.Precision
+	points := t.Points()
+	key := jsonString(t.Key())
+	fmt.Fprintf(w, "{\"type\":\"Feature\",\"id\":%s,\"geometry\":{\"type\":\"LineString\",", key)
+	writeArray(w, "coordinates", points, func(p Point) {
+		if p.HasEle {
+			fmt.Fprintf(w, "[%.*f,%.*f,%.*f]", prec.LL, p.Lon, prec.LL, p.Lat, prec.EL, p.Ele)
+		} else {
+			fmt.Fprintf(w, "[%.*f,%.*f]", prec.LL, p.Lon, prec.LL, p.Lat)
+		}
+	})
+	fmt.Fprintf(w, "},\"properties\":{\"id\":%s,\"name\":%s,\"start\":%s,",
+		key, jsonString(t.Name), jsonString(formatTime(t.Start())))
+	writeDT(w, points, prec)
+	fmt.Fprint(w, ",")
+	writeDD(w, points, prec)
+	fmt.Fprint(w, ",")
+	writeInts(w, "hr", points, Point.HeartRate)
+	writeInts(w, "pw", points, Point.Power)
+	writeBreakdown(w, t, f)
+	writeStats(w, "st", rounded(t, prec).Stats(), prec)
+	fmt.Fprint(w, "}}")
+}
+
+// round округляет число до prec знаков после запятой так же, как при записи
+func round(x float64, prec int) float64 {
+	x, _ = strconv.ParseFloat(strconv.FormatFloat(x, 'f', prec, 64), 64)
+	return x
+}
+
+// rounded возвращает трек из одного сегмента с точками, округленными с точностью prec так
+// же, как при записи json-данных. Итоги поездки по нему совпадают с итогами прочитанного
+// обратно трека
+func rounded(t *Track, prec Precision) *Track {
+	points := t.Points()
+	res := make([]Point, len(points))
+	var offset float64
+	for i, p := range points {
+		if i > 0 {
+			offset += round(p.Time.Sub(points[i-1].Time).Seconds(), prec.DT)
+		}
+		res[i] = Point{
+			Lat:    round(p.Lat, prec.LL),
+			Lon:    round(p.Lon, prec.LL),
+			Time:   points[0].Time.Add(time.Duration(math.Round(offset * float64(time.Second)))),
+			Dist:   round(p.Dist, prec.DD),
+			Ele:    round(p.Ele, prec.EL),
+			HasEle: p.HasEle,
+		}
+	}
+	rt := FromPoints(res)
+	rt.HiddenStart, rt.HiddenEnd = t.HiddenStart, t.HiddenEnd
+	return rt
+}
+
+// jsonString возвращает строку в кавычках json
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
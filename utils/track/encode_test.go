@@ -0,0 +1,51 @@
+package track
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func ExampleTrack_Encode() {
+	trk, _ := Parse(strings.NewReader(xmlSegments))
+	for _, f := range []Format{JS, JSON, GeoJSON} {
+		f.Precision = Precision{LL: 5, DD: 1}
+		trk.Encode(os.Stdout, f)
+		os.Stdout.WriteString("\n")
+	}
+	// Output:
+	// tracks['1622728859']={"ll":[[59.90758,30.25624],[59.90762,30.25632],[59.90759,30.25642]],"dt":[0,2,4],"dd":[0.0,6.0,6.6],"name":"Утро","st":{"dist":12.6,"elapsed":6,"moving":2,"avgSpeed":10.80,"maxSpeed":10.80,"bbox":[59.90758,30.25624,59.90762,30.25642],"start":[59.90758,30.25624],"end":[59.90759,30.25642]}}
+	// {"id":"1622728859","ll":[[59.90758,30.25624],[59.90762,30.25632],[59.90759,30.25642]],"dt":[0,2,4],"dd":[0.0,6.0,6.6],"name":"Утро","st":{"dist":12.6,"elapsed":6,"moving":2,"avgSpeed":10.80,"maxSpeed":10.80,"bbox":[59.90758,30.25624,59.90762,30.25642],"start":[59.90758,30.25624],"end":[59.90759,30.25642]}}
+	// {"type":"Feature","id":"1622728859","geometry":{"type":"LineString","coordinates":[[30.25624,59.90758],[30.25632,59.90762],[30.25642,59.90759]]},"properties":{"id":"1622728859","name":"Утро","start":"2021-06-03T14:00:59Z","dt":[0,2,4],"dd":[0.0,6.0,6.6],"st":{"dist":12.6,"elapsed":6,"moving":2,"avgSpeed":10.80,"maxSpeed":10.80,"bbox":[59.90758,30.25624,59.90762,30.25642],"start":[59.90758,30.25624],"end":[59.90759,30.25642]}}}
+}
+
+func TestEncodeGeoJSON(t *testing.T) {
+	trk, _ := Parse(strings.NewReader(xmlSegments))
+	trk.Name = `"Утро" \ вечер`
+	var buf strings.Builder
+	if err := trk.Encode(&buf, GeoJSON); err != nil {
+		t.Fatal(err)
+	}
+	var feature struct {
+		Type     string
+		Geometry struct {
+			Type        string
+			Coordinates [][2]float64
+		}
+		Properties struct {
+			Name string
+			DT   []float64
+			DD   []float64
+		}
+	}
+	if err := json.Unmarshal([]byte(buf.String()), &feature); err != nil {
+		t.Fatalf("неверный json: %s", err.Error())
+	}
+	if feature.Type != "Feature" || feature.Geometry.Type != "LineString" || feature.Properties.Name != trk.Name {
+		t.Errorf("неверный объект %+v", feature)
+	}
+	if n := len(feature.Geometry.Coordinates); n != trk.Len() || len(feature.Properties.DT) != n || len(feature.Properties.DD) != n {
+		t.Errorf("массивы не соответствуют координатам: %+v", feature)
+	}
+}
@@ -0,0 +1,116 @@
+package track
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GPX - формат GPX 1.1 с сегментами трека, высотами и расширениями точек исходного файла
+var GPX = Format{Name: "gpx", Precision: DefaultPrecision}
+
+// KML - формат Google Earth: линии сегментов трека с интервалом времени поездки
+var KML = Format{Name: "kml", Precision: DefaultPrecision}
+
+// CSV - таблица точек с колонками time,lat,lon,dt,dist,speed: время UTC, координаты,
+// интервал времени в секундах и расстояние в метрах от предыдущей точки, скорость в км/ч
+var CSV = Format{Name: "csv", Precision: DefaultPrecision}
+
+// kmlColor - цвет трека на сайте #e600aa в формате KML aabbggrr
+const kmlColor = "ffaa00e6"
+
+// xmlText возвращает строку, экранированную для текста XML
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// formatTime возвращает время в формате RFC 3339 UTC
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// encodeGPX записывает трек в формате GPX
+func encodeGPX(w io.Writer, t *Track, prec Precision) {
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprint(w, `<gpx version="1.1" creator="gpx2js" xmlns="http://www.topografix.com/GPX/1/1"`)
+	prefixes := make([]string, 0, len(t.Namespaces))
+	for prefix := range t.Namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		fmt.Fprintf(w, ` xmlns:%s="%s"`, prefix, xmlText(t.Namespaces[prefix]))
+	}
+	fmt.Fprintf(w, ">\n\t<metadata>\n\t\t<time>%s</time>\n\t</metadata>\n\t<trk>\n", formatTime(t.Start()))
+	if t.Name != "" {
+		fmt.Fprintf(w, "\t\t<name>%s</name>\n", xmlText(t.Name))
+	}
+	for _, s := range t.Segments {
+		fmt.Fprint(w, "\t\t<trkseg>\n")
+		for _, p := range s.Points {
+			fmt.Fprintf(w, "\t\t\t<trkpt lat=\"%.*f\" lon=\"%.*f\">", prec.LL, p.Lat, prec.LL, p.Lon)
+			if p.HasEle {
+				fmt.Fprintf(w, "<ele>%s</ele>", strconv.FormatFloat(p.Ele, 'f', -1, 64))
+			}
+			fmt.Fprintf(w, "<time>%s</time>", formatTime(p.Time))
+			if p.Ext != "" {
+				fmt.Fprintf(w, "<extensions>%s</extensions>", p.Ext)
+			}
+			fmt.Fprint(w, "</trkpt>\n")
+		}
+		fmt.Fprint(w, "\t\t</trkseg>\n")
+	}
+	fmt.Fprint(w, "\t</trk>\n</gpx>\n")
+}
+
+// encodeKML записывает трек в формате KML
+func encodeKML(w io.Writer, t *Track, prec Precision) {
+	name := t.Name
+	if name == "" {
+		name = t.Start().UTC().Format("2006-01-02 15:04")
+	}
+	name = xmlText(name)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprint(w, `<kml xmlns="http://www.opengis.net/kml/2.2">`+"\n")
+	fmt.Fprintf(w, "<Document>\n\t<name>%s</name>\n", name)
+	fmt.Fprintf(w, "\t<Style id=\"track\"><LineStyle><color>%s</color><width>4</width></LineStyle></Style>\n", kmlColor)
+	fmt.Fprintf(w, "\t<Placemark>\n\t\t<name>%s</name>\n", name)
+	fmt.Fprintf(w, "\t\t<TimeSpan><begin>%s</begin><end>%s</end></TimeSpan>\n", formatTime(t.Start()), formatTime(t.End()))
+	fmt.Fprint(w, "\t\t<styleUrl>#track</styleUrl>\n\t\t<MultiGeometry>\n")
+	for _, s := range t.Segments {
+		fmt.Fprint(w, "\t\t\t<LineString><tessellate>1</tessellate><coordinates>")
+		for i, p := range s.Points {
+			if i > 0 {
+				fmt.Fprint(w, " ")
+			}
+			fmt.Fprintf(w, "%.*f,%.*f", prec.LL, p.Lon, prec.LL, p.Lat)
+			if p.HasEle {
+				fmt.Fprintf(w, ",%s", strconv.FormatFloat(p.Ele, 'f', -1, 64))
+			}
+		}
+		fmt.Fprint(w, "</coordinates></LineString>\n")
+	}
+	fmt.Fprint(w, "\t\t</MultiGeometry>\n\t</Placemark>\n</Document>\n</kml>\n")
+}
+
+// encodeCSV записывает точки трека в формате CSV
+func encodeCSV(w io.Writer, points []Point, prec Precision) {
+	fmt.Fprint(w, "time,lat,lon,dt,dist,speed\n")
+	for i, p := range points {
+		var dt, speed float64
+		if i > 0 {
+			dt = p.Time.Sub(points[i-1].Time).Seconds()
+		}
+		if dt > 0 {
+			speed = p.Dist / dt * 3.6
+		}
+		fmt.Fprintf(w, "%s,%.*f,%.*f,%.*f,%.*f,%.*f\n",
+			formatTime(p.Time), prec.LL, p.Lat, prec.LL, p.Lon, prec.DT, dt, prec.DD, p.Dist, prec.DD, speed)
+	}
+}
@@ -0,0 +1,71 @@
+package track
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func ExampleTrack_Encode_csv() {
+	trk, _ := Parse(strings.NewReader(xmlSegments))
+	trk.Encode(os.Stdout, CSV)
+	// Output:
+	// time,lat,lon,dt,dist,speed
+	// 2021-06-03T14:00:59Z,59.907581,30.256245,0,0.00,0.00
+	// 2021-06-03T14:01:01Z,59.907620,30.256319,2,5.99,10.78
+	// 2021-06-03T14:01:05Z,59.907591,30.256423,4,6.64,5.97
+}
+
+func ExampleTrack_Encode_kml() {
+	trk, _ := Parse(strings.NewReader(xmlSegments))
+	trk.Encode(os.Stdout, Format{Name: "kml", Precision: Precision{LL: 5}})
+	// Output:
+	// <?xml version="1.0" encoding="UTF-8"?>
+	// <kml xmlns="http://www.opengis.net/kml/2.2">
+	// <Document>
+	// 	<name>Утро</name>
+	// 	<Style id="track"><LineStyle><color>ffaa00e6</color><width>4</width></LineStyle></Style>
+	// 	<Placemark>
+	// 		<name>Утро</name>
+	// 		<TimeSpan><begin>2021-06-03T14:00:59Z</begin><end>2021-06-03T14:01:05Z</end></TimeSpan>
+	// 		<styleUrl>#track</styleUrl>
+	// 		<MultiGeometry>
+	// 			<LineString><tessellate>1</tessellate><coordinates>30.25624,59.90758 30.25632,59.90762</coordinates></LineString>
+	// 			<LineString><tessellate>1</tessellate><coordinates>30.25642,59.90759</coordinates></LineString>
+	// 		</MultiGeometry>
+	// 	</Placemark>
+	// </Document>
+	// </kml>
+}
+
+func TestEncodeGPX(t *testing.T) {
+	src, err := Parse(strings.NewReader(xml1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Segments[0].Points[1].Ele, src.Segments[0].Points[1].HasEle = 12.5, true
+	var buf bytes.Buffer
+	if err = src.Encode(&buf, GPX); err != nil {
+		t.Fatal(err)
+	}
+	trk, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Name != src.Name || trk.Namespaces["gpxtpx"] != src.Namespaces["gpxtpx"] {
+		t.Errorf("неверные название или пространства имен: %s %v", trk.Name, trk.Namespaces)
+	}
+	got, want := trk.Points(), src.Points()
+	if len(got) != len(want) {
+		t.Fatalf("точек %d вместо %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("точка %d: %+v вместо %+v", i, got[i], want[i])
+		}
+	}
+	if !strings.Contains(want[0].Ext, "<gpxtpx:TrackPointExtension>") {
+		t.Errorf("нет расширений точки: %q", want[0].Ext)
+	}
+}
@@ -0,0 +1,413 @@
+package track
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filter - этап обработки трека
+type Filter interface {
+	Name() string                     // название этапа
+	Process(t *Track) (Report, error) // обработка трека на месте
+}
+
+// Report - что изменил этап обработки трека
+type Report struct {
+	Removed int // количество удаленных точек
+	Changed int // количество точек, у которых изменились данные
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("удалено точек %d, изменено %d", r.Removed, r.Changed)
+}
+
+// StageReport - отчет одного этапа конвейера
+type StageReport struct {
+	Stage string // название этапа
+	Report
+}
+
+// Pipeline - упорядоченные этапы обработки трека
+type Pipeline []Filter
+
+// Process выполняет этапы по порядку и возвращает их отчеты. При ошибке обработка прерывается
+func (p Pipeline) Process(t *Track) ([]StageReport, error) {
+	reports := make([]StageReport, 0, len(p))
+	for _, f := range p {
+		r, err := f.Process(t)
+		if err != nil {
+			return reports, fmt.Errorf("%s: %s", f.Name(), err.Error())
+		}
+		reports = append(reports, StageReport{f.Name(), r})
+	}
+	return reports, nil
+}
+
+// FilterSpec - описание этапа обработки в настройках: название и числовые параметры
+type FilterSpec struct {
+	Filter string             `json:"filter"`
+	Params map[string]float64 `json:"params,omitempty"`
+}
+
+// filterParams - параметры этапов и их значения по умолчанию
+var filterParams = map[string]map[string]float64{
+	"dedupe":   {},
+	"outliers": {"maxSpeed": DefaultOptions.MaxSpeed},
+	"smooth":   {"count": float64(DefaultOptions.SmoothCount), "time": float64(DefaultOptions.SmoothTime)},
+	"simplify": {"tolerance": 2},
+	"trim":     {"start": 0, "end": 0},
+}
+
+// NewFilter создает этап обработки по описанию. Незаданные параметры берутся по умолчанию
+func NewFilter(spec FilterSpec) (Filter, error) {
+	defaults, ok := filterParams[spec.Filter]
+	if !ok {
+		names := make([]string, 0, len(filterParams))
+		for name := range filterParams {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("неизвестный этап обработки '%s', допустимы: %s", spec.Filter, strings.Join(names, ", "))
+	}
+	params := make(map[string]float64, len(defaults))
+	for name, value := range defaults {
+		params[name] = value
+	}
+	for name, value := range spec.Params {
+		if _, ok := defaults[name]; !ok {
+			return nil, fmt.Errorf("у этапа обработки '%s' нет параметра '%s'", spec.Filter, name)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("отрицательный параметр '%s' этапа обработки '%s'", name, spec.Filter)
+		}
+		params[name] = value
+	}
+	switch spec.Filter {
+	case "dedupe":
+		return Dedupe{}, nil
+	case "outliers":
+		return Outliers{MaxSpeed: params["maxSpeed"]}, nil
+	case "smooth":
+		return Smooth{Count: int(params["count"]), Time: int(params["time"])}, nil
+	case "simplify":
+		return Simplify{Tolerance: params["tolerance"]}, nil
+	default:
+		return Trim{Start: params["start"], End: params["end"]}, nil
+	}
+}
+
+// NewPipeline создает конвейер по описаниям этапов
+func NewPipeline(specs []FilterSpec) (Pipeline, error) {
+	p := make(Pipeline, 0, len(specs))
+	for _, spec := range specs {
+		f, err := NewFilter(spec)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, f)
+	}
+	return p, nil
+}
+
+// flat - точки трека подряд с номерами их сегментов
+type flat struct {
+	points []Point
+	segs   []int
+}
+
+func (t *Track) flatten() flat {
+	f := flat{points: make([]Point, 0, t.Len()), segs: make([]int, 0, t.Len())}
+	for i, s := range t.Segments {
+		for _, p := range s.Points {
+			f.add(p, i)
+		}
+	}
+	return f
+}
+
+func (f *flat) add(p Point, seg int) {
+	f.points = append(f.points, p)
+	f.segs = append(f.segs, seg)
+}
+
+// dropLast удаляет последнюю точку
+func (f *flat) dropLast() {
+	f.points = f.points[:len(f.points)-1]
+	f.segs = f.segs[:len(f.segs)-1]
+}
+
+// apply заменяет сегменты трека точками f, пустые сегменты не сохраняются
+func (f *flat) apply(t *Track) {
+	t.Segments = nil
+	for i := 0; i < len(f.points); {
+		j := i + 1
+		for j < len(f.points) && f.segs[j] == f.segs[i] {
+			j++
+		}
+		t.Segments = append(t.Segments, Segment{Points: f.points[i:j:j]})
+		i = j
+	}
+}
+
+// resetDist отсчитывает расстояния точек по прямой от предыдущей точки
+func (t *Track) resetDist() {
+	var prev *Point
+	for i := range t.Segments {
+		points := t.Segments[i].Points
+		for j := range points {
+			if prev == nil {
+				points[j].Dist = 0
+			} else {
+				points[j].Dist = PointDistance(*prev, points[j])
+			}
+			prev = &points[j]
+		}
+	}
+}
+
+// keep оставляет точки, для которых keep возвращает true. Расстояние удаленных точек
+// прибавляется к следующей оставшейся точке, у первой точки трека оно нулевое
+func (t *Track) keep(keep func(i int, p Point) bool) (removed int) {
+	f := t.flatten()
+	out := flat{points: f.points[:0], segs: f.segs[:0]}
+	var carry float64
+	for i, p := range f.points {
+		if !keep(i, p) {
+			carry += p.Dist
+			removed++
+			continue
+		}
+		if len(out.points) == 0 {
+			p.Dist = 0
+		} else {
+			p.Dist += carry
+		}
+		carry = 0
+		out.add(p, f.segs[i])
+	}
+	out.apply(t)
+	return
+}
+
+// hideEnds оставляет точки трека с номерами от first до last и прибавляет к скрытым метрам
+// трека расстояния до первой и после последней оставшейся точки
+func (t *Track) hideEnds(first int, last int) (removed int) {
+	if points := t.Points(); first <= last {
+		for i := 0; i <= first; i++ {
+			t.HiddenStart += points[i].Dist
+		}
+		for i := last + 1; i < len(points); i++ {
+			t.HiddenEnd += points[i].Dist
+		}
+	}
+	return t.keep(func(i int, p Point) bool { return i >= first && i <= last })
+}
+
+// Dedupe удаляет точки с неизменившимися координатами и с временем меньше, чем у предыдущей
+// точки. Из точек с одинаковым временем остается последняя
+type Dedupe struct{}
+
+func (Dedupe) Name() string { return "dedupe" }
+
+func (Dedupe) Process(t *Track) (Report, error) {
+	var r Report
+	f := t.flatten()
+	out := flat{}
+	for i, p := range f.points {
+		if n := len(out.points); n > 0 {
+			prev := out.points[n-1]
+			dt := p.Time.Sub(prev.Time)
+			if dt < 0 { // время новой точки меньше предыдущей - игнорируем
+				r.Removed++
+				continue
+			} else if dt == 0 { // время новой точки не изменилось - удаляем предыдущую, чтобы заменить ее
+				out.dropLast()
+				r.Removed++
+			} else if PointDistance(prev, p) <= 0 {
+				r.Removed++
+				continue
+			}
+		}
+		out.add(p, f.segs[i])
+	}
+	out.apply(t)
+	t.resetDist()
+	return r, nil
+}
+
+// Outliers удаляет точки, скорость до которых от предыдущей оставшейся точки больше MaxSpeed м/с
+type Outliers struct {
+	MaxSpeed float64
+}
+
+func (Outliers) Name() string { return "outliers" }
+
+func (o Outliers) Process(t *Track) (Report, error) {
+	var r Report
+	if o.MaxSpeed <= 0 {
+		return r, fmt.Errorf("неверная максимальная скорость %g", o.MaxSpeed)
+	}
+	var prev *Point
+	r.Removed = t.keep(func(i int, p Point) bool {
+		if prev != nil {
+			dt := p.Time.Sub(prev.Time).Seconds()
+			if dt > 0 && PointDistance(*prev, p)/dt > o.MaxSpeed {
+				return false
+			}
+		}
+		prev = &p
+		return true
+	})
+	t.resetDist()
+	return r, nil
+}
+
+// Smooth сглаживает расстояния между точками: расстояние до точки - это среднее расстояние
+// между отдаленными соседними точками, не более Count точек и Time секунд назад и вперед
+type Smooth struct {
+	Count int
+	Time  int
+}
+
+func (Smooth) Name() string { return "smooth" }
+
+func (s Smooth) Process(t *Track) (Report, error) {
+	var r Report
+	if s.Count < 1 {
+		return r, fmt.Errorf("неверное количество точек сглаживания %d", s.Count)
+	}
+	f := t.flatten()
+	points := f.points
+	lastPointIndex := len(points) - 1
+	// сглаживание скоростей по отдаленным точкам
+	smoothCount, smoothTime := s.Count, time.Duration(s.Time)
+	for i := 1; i <= lastPointIndex; i++ {
+		l := i - smoothCount
+		if l < 0 {
+			l = 0
+		}
+		minTime := points[i].Time.Add(-time.Second * smoothTime)
+		for l < (i-1) && points[l].Time.Before(minTime) {
+			l++
+		}
+		maxTime := points[i].Time.Add(time.Second * smoothTime)
+		m := i + smoothCount
+		if m > lastPointIndex {
+			m = lastPointIndex
+		}
+		for m > i && points[m].Time.After(maxTime) {
+			m--
+		}
+		dist := PointDistance(points[l], points[m]) / float64(m-l)
+		if dist != points[i].Dist {
+			r.Changed++
+		}
+		points[i].Dist = dist
+	}
+	f.apply(t)
+	return r, nil
+}
+
+// Simplify удаляет точки, отклоняющиеся от линии между оставшимися соседними точками
+// меньше, чем на Tolerance метров (алгоритм Рамера-Дугласа-Пекера). Первая и последняя
+// точки сегментов остаются
+type Simplify struct {
+	Tolerance float64
+}
+
+func (Simplify) Name() string { return "simplify" }
+
+func (s Simplify) Process(t *Track) (Report, error) {
+	var r Report
+	keep := make([]bool, 0, t.Len())
+	for _, seg := range t.Segments {
+		keep = append(keep, SimplifyPoints(seg.Points, s.Tolerance)...)
+	}
+	r.Removed = t.keep(func(i int, p Point) bool { return keep[i] })
+	return r, nil
+}
+
+// SimplifyPoints возвращает признаки точек, которые остаются после упрощения линии с
+// допуском tolerance метров
+func SimplifyPoints(points []Point, tolerance float64) []bool {
+	keep := make([]bool, len(points))
+	if len(points) == 0 {
+		return keep
+	}
+	keep[0], keep[len(points)-1] = true, true
+	// точки в локальной плоской проекции в метрах относительно первой точки
+	cos := math.Cos(Deg2Rad(points[0].Lat))
+	xy := make([][2]float64, len(points))
+	for i, p := range points {
+		xy[i] = [2]float64{
+			Deg2Rad(p.Lon-points[0].Lon) * cos * EarthRadius,
+			Deg2Rad(p.Lat-points[0].Lat) * EarthRadius,
+		}
+	}
+	var simplify func(first int, last int)
+	simplify = func(first int, last int) {
+		maxDist, index := 0.0, 0
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xy[i], xy[first], xy[last]); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+		if maxDist > tolerance {
+			keep[index] = true
+			simplify(first, index)
+			simplify(index, last)
+		}
+	}
+	simplify(0, len(points)-1)
+	return keep
+}
+
+// segmentDistance возвращает расстояние от точки p до отрезка ab на плоскости
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	l := dx*dx + dy*dy
+	if l > 0 {
+		k := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / l
+		if k > 1 {
+			a = b
+		} else if k > 0 {
+			a = [2]float64{a[0] + k*dx, a[1] + k*dy}
+		}
+	}
+	return math.Hypot(p[0]-a[0], p[1]-a[1])
+}
+
+// Trim удаляет первые Start и последние End метров трека, чтобы не показывать, где
+// поездка началась и закончилась
+type Trim struct {
+	Start float64
+	End   float64
+}
+
+func (Trim) Name() string { return "trim" }
+
+func (tr Trim) Process(t *Track) (Report, error) {
+	var r Report
+	var total float64
+	for _, seg := range t.Segments {
+		for _, p := range seg.Points {
+			total += p.Dist
+		}
+	}
+	var dist float64
+	first, last := t.Len(), -1
+	for i, p := range t.Points() {
+		dist += p.Dist
+		if dist >= tr.Start && dist <= total-tr.End {
+			if i < first {
+				first = i
+			}
+			last = i
+		}
+	}
+	r.Removed = t.hideEnds(first, last)
+	return r, nil
+}
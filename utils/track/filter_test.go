@@ -0,0 +1,90 @@
+package track
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// linePoints возвращает n точек через каждые step метров на север с интервалом в секунду
+func linePoints(n int, step float64) []Point {
+	t0 := time.Date(2021, 6, 3, 14, 0, 0, 0, time.UTC)
+	points := make([]Point, n)
+	for i := range points {
+		points[i] = Point{Lat: 59.9 + float64(i)*step/EarthRadius*180/math.Pi, Lon: 30.25, Time: t0.Add(time.Duration(i) * time.Second)}
+	}
+	return points
+}
+
+func trackDist(t *Track) (dist float64) {
+	for _, p := range t.Points() {
+		dist += p.Dist
+	}
+	return
+}
+
+func TestSimplify(t *testing.T) {
+	// 6 точек на север и 5 точек на восток от последней из них
+	points := linePoints(11, 5)
+	for i := 6; i < len(points); i++ {
+		points[i].Lat = points[5].Lat
+		points[i].Lon = points[5].Lon + float64(i-5)*0.0001
+	}
+	trk := FromPoints(points)
+	trk.resetDist()
+	dist := trackDist(trk)
+	r, err := Simplify{Tolerance: 1}.Process(trk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Removed != 8 || trk.Len() != 3 || trk.Points()[1].Time != points[5].Time {
+		t.Errorf("удалено %d точек, осталось %d", r.Removed, trk.Len())
+	}
+	if math.Abs(trackDist(trk)-dist) > 1e-6 {
+		t.Errorf("расстояние изменилось: %f -> %f", dist, trackDist(trk))
+	}
+}
+
+func TestTrim(t *testing.T) {
+	trk := FromPoints(linePoints(21, 10))
+	trk.resetDist()
+	r, _ := Trim{Start: 45, End: 25}.Process(trk)
+	points := trk.Points()
+	if r.Removed != 8 || len(points) != 13 || points[0].Dist != 0 {
+		t.Errorf("удалено %d точек, осталось %d", r.Removed, len(points))
+	}
+	if math.Abs(trackDist(trk)-120) > 1e-6 {
+		t.Errorf("неверное расстояние %f", trackDist(trk))
+	}
+}
+
+func ExamplePipeline_Process() {
+	trk, _ := Parse(strings.NewReader(xml1))
+	p, _ := NewPipeline([]FilterSpec{
+		{Filter: "dedupe"},
+		{Filter: "outliers", Params: map[string]float64{"maxSpeed": 5}},
+		{Filter: "smooth"},
+	})
+	reports, _ := p.Process(trk)
+	for _, r := range reports {
+		fmt.Printf("%s: %s\n", r.Stage, r.Report)
+	}
+	fmt.Println(trk.Total, trk.Len())
+	// Output:
+	// dedupe: удалено точек 1, изменено 0
+	// outliers: удалено точек 0, изменено 0
+	// smooth: удалено точек 0, изменено 0
+	// 4 3
+}
+
+func ExampleNewFilter() {
+	_, err := NewFilter(FilterSpec{Filter: "smooth", Params: map[string]float64{"points": 3}})
+	fmt.Println(err)
+	_, err = NewFilter(FilterSpec{Filter: "median"})
+	fmt.Println(err)
+	// Output:
+	// у этапа обработки 'smooth' нет параметра 'points'
+	// неизвестный этап обработки 'median', допустимы: dedupe, outliers, simplify, smooth, trim
+}
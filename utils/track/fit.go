@@ -0,0 +1,225 @@
+package track
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// fitEpoch - начало отсчета времени FIT-файлов
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// глобальные номера сообщений FIT-файла и номера их полей, которые читаются
+const (
+	fitMsgLap    = 19  // круг
+	fitMsgRecord = 20  // точка трека
+	fitTimestamp = 253 // время сообщения, общее для всех сообщений
+
+	fitLapStart = 2 // время начала круга
+
+	fitLat     = 0  // широта в полуокружностях
+	fitLon     = 1  // долгота в полуокружностях
+	fitAlt     = 2  // высота: 5 единиц на метр со сдвигом 500 м
+	fitHR      = 3  // пульс
+	fitPower   = 7  // мощность
+	fitAltEnhd = 78 // высота с большим диапазоном, так же как fitAlt
+)
+
+// fitField - описание поля сообщения FIT-файла
+type fitField struct {
+	num      byte // номер поля в сообщении
+	size     int  // размер поля в байтах
+	baseType byte // базовый тип значения
+}
+
+// fitDef - описание сообщений одного локального типа
+type fitDef struct {
+	order  binary.ByteOrder
+	global uint16     // глобальный номер сообщения
+	fields []fitField // поля по порядку
+	skip   int        // размер полей разработчика, которые пропускаются
+}
+
+// fitValue возвращает целое значение поля data базового типа baseType и признак того, что
+// значение задано. Поля других типов и массивы считаются незаданными
+func fitValue(data []byte, baseType byte, order binary.ByteOrder) (int64, bool) {
+	switch baseType & 0x1f {
+	case 0x00, 0x02: // enum, uint8
+		return int64(data[0]), len(data) == 1 && data[0] != 0xff
+	case 0x01: // sint8
+		return int64(int8(data[0])), len(data) == 1 && data[0] != 0x7f
+	case 0x04: // uint16
+		if len(data) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(data)
+		return int64(v), v != 0xffff
+	case 0x03: // sint16
+		if len(data) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(data)
+		return int64(int16(v)), v != 0x7fff
+	case 0x06: // uint32
+		if len(data) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(data)
+		return int64(v), v != 0xffffffff
+	case 0x05: // sint32
+		if len(data) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(data)
+		return int64(int32(v)), v != 0x7fffffff
+	}
+	return 0, false
+}
+
+// fitCRC возвращает контрольную сумму FIT-файла для данных data
+func fitCRC(data []byte) uint16 {
+	table := [16]uint16{0x0000, 0xcc01, 0xd801, 0x1400, 0xf001, 0x3c00, 0x2800, 0xe401,
+		0xa001, 0x6c00, 0x7800, 0xb401, 0x5000, 0x9c01, 0x8801, 0x4400}
+	var crc uint16
+	for _, b := range data {
+		crc = (crc >> 4) ^ table[crc&0xf] ^ table[b&0xf]
+		crc = (crc >> 4) ^ table[crc&0xf] ^ table[b>>4]
+	}
+	return crc
+}
+
+// ParseFIT читает трек из FIT-файла без какой-либо обработки точек так же, как Parse.
+// Точки берутся из сообщений record, время начала кругов lap после первого - круги трека,
+// пульс и мощность записываются в расширения точек. Трек состоит из одного сегмента,
+// точки без координат или времени пропускаются
+func ParseFIT(r io.Reader) (*Track, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || int(data[0]) < 12 || len(data) < int(data[0]) || !bytes.Equal(data[8:12], []byte(".FIT")) {
+		return nil, errors.New("не FIT-файл")
+	}
+	end := int(data[0]) + int(binary.LittleEndian.Uint32(data[4:8]))
+	if len(data) < end+2 {
+		return nil, errors.New("FIT-файл обрезан")
+	}
+	if fitCRC(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return nil, errors.New("неверная контрольная сумма FIT-файла")
+	}
+	t := &Track{}
+	var f flat
+	var laps []time.Time
+	var defs [16]*fitDef
+	var last uint32 // время последнего сообщения для сжатых заголовков
+	for pos := int(data[0]); pos < end; {
+		h := data[pos]
+		pos++
+		local, compressed := h&0x0f, false
+		switch {
+		case h&0x80 != 0: // сжатый заголовок со смещением времени
+			local, compressed = (h>>5)&0x03, true
+			offset := uint32(h & 0x1f)
+			ts := last&^0x1f | offset
+			if offset < last&0x1f {
+				ts += 0x20
+			}
+			last = ts
+		case h&0x40 != 0: // описание сообщений
+			if pos+5 > end {
+				return nil, errors.New("FIT-файл обрезан")
+			}
+			d := &fitDef{order: binary.LittleEndian}
+			if data[pos+1] == 1 {
+				d.order = binary.BigEndian
+			}
+			d.global = d.order.Uint16(data[pos+2 : pos+4])
+			n := int(data[pos+4])
+			pos += 5
+			if pos+3*n > end {
+				return nil, errors.New("FIT-файл обрезан")
+			}
+			for i := 0; i < n; i++ {
+				d.fields = append(d.fields, fitField{data[pos], int(data[pos+1]), data[pos+2]})
+				pos += 3
+			}
+			if h&0x20 != 0 { // поля разработчика
+				if pos >= end {
+					return nil, errors.New("FIT-файл обрезан")
+				}
+				n = int(data[pos])
+				pos++
+				if pos+3*n > end {
+					return nil, errors.New("FIT-файл обрезан")
+				}
+				for i := 0; i < n; i++ {
+					d.skip += int(data[pos+1])
+					pos += 3
+				}
+			}
+			defs[local] = d
+			continue
+		}
+		d := defs[local]
+		if d == nil {
+			return nil, fmt.Errorf("FIT-файл: сообщение без описания на позиции %d", pos-1)
+		}
+		values := make(map[byte]int64)
+		for _, fd := range d.fields {
+			if pos+fd.size > end {
+				return nil, errors.New("FIT-файл обрезан")
+			}
+			if v, ok := fitValue(data[pos:pos+fd.size], fd.baseType, d.order); ok {
+				values[fd.num] = v
+			}
+			pos += fd.size
+		}
+		pos += d.skip
+		if ts, ok := values[fitTimestamp]; ok && !compressed {
+			last = uint32(ts)
+		}
+		switch d.global {
+		case fitMsgLap:
+			if start, ok := values[fitLapStart]; ok {
+				laps = append(laps, fitEpoch.Add(time.Duration(start)*time.Second))
+			}
+		case fitMsgRecord:
+			lat, okLat := values[fitLat]
+			lon, okLon := values[fitLon]
+			if !okLat || !okLon || last == 0 {
+				continue
+			}
+			p := Point{
+				Lat:  float64(lat) * 180 / (1 << 31),
+				Lon:  float64(lon) * 180 / (1 << 31),
+				Time: fitEpoch.Add(time.Duration(last) * time.Second),
+			}
+			if alt, ok := values[fitAltEnhd]; ok {
+				p.Ele, p.HasEle = float64(alt)/5-500, true
+			} else if alt, ok := values[fitAlt]; ok {
+				p.Ele, p.HasEle = float64(alt)/5-500, true
+			}
+			if hr, ok := values[fitHR]; ok && hr > 0 {
+				p.Ext = hrExt(int(hr))
+				t.Namespaces = map[string]string{"gpxtpx": tpxNamespace}
+			}
+			if pw, ok := values[fitPower]; ok {
+				p.Ext += powerExt(int(pw))
+			}
+			f.add(p, 0)
+		}
+	}
+	f.apply(t)
+	t.Total = t.Len()
+	t.resetDist()
+	for _, lap := range laps {
+		if lap.After(t.Start()) {
+			t.Laps = append(t.Laps, lap)
+		}
+	}
+	sortLaps(t)
+	return t, nil
+}
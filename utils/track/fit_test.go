@@ -0,0 +1,110 @@
+package track
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// fitWriter собирает тестовый FIT-файл
+type fitWriter struct {
+	bytes.Buffer
+	order binary.ByteOrder
+}
+
+// define записывает описание сообщений локального типа local с полями fields из троек
+// номер, размер, базовый тип и одним полем разработчика размером 2 байта
+func (w *fitWriter) define(local byte, global uint16, fields ...[3]byte) {
+	w.WriteByte(0x40 | 0x20 | local)
+	arch := byte(0)
+	if w.order == binary.BigEndian {
+		arch = 1
+	}
+	w.Write([]byte{0, arch})
+	binary.Write(w, w.order, global)
+	w.WriteByte(byte(len(fields)))
+	for _, f := range fields {
+		w.Write(f[:])
+	}
+	w.Write([]byte{1, 0, 2, 0})
+}
+
+// message записывает сообщение локального типа с заголовком header и значениями полей
+// values, за которыми следует поле разработчика
+func (w *fitWriter) message(header byte, values ...interface{}) {
+	w.WriteByte(header)
+	for _, v := range values {
+		binary.Write(w, w.order, v)
+	}
+	w.Write([]byte{0xaa, 0xbb})
+}
+
+// file возвращает FIT-файл с заголовком и контрольной суммой
+func (w *fitWriter) file() []byte {
+	header := []byte{14, 0x20, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T', 0, 0}
+	binary.LittleEndian.PutUint32(header[4:8], uint32(w.Len()))
+	binary.LittleEndian.PutUint16(header[12:14], fitCRC(header[:12]))
+	data := append(header, w.Bytes()...)
+	var crc [2]byte
+	binary.LittleEndian.PutUint16(crc[:], fitCRC(data))
+	return append(data, crc[:]...)
+}
+
+func TestParseFIT(t *testing.T) {
+	t0 := time.Date(2022, 4, 19, 8, 58, 0, 0, time.UTC)
+	ts := func(d time.Duration) uint32 { return uint32(t0.Add(d).Sub(fitEpoch) / time.Second) }
+	semi := func(deg float64) int32 { return int32(math.Round(deg * (1 << 31) / 180)) }
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		w := &fitWriter{order: order}
+		// точка: время, широта, долгота, высота, пульс, мощность
+		w.define(0, fitMsgRecord, [3]byte{fitTimestamp, 4, 0x86}, [3]byte{fitLat, 4, 0x85}, [3]byte{fitLon, 4, 0x85},
+			[3]byte{fitAltEnhd, 4, 0x86}, [3]byte{fitHR, 1, 0x02}, [3]byte{fitPower, 2, 0x84})
+		w.message(0, ts(0), semi(59.95), semi(30.3), uint32((10+500)*5), uint8(120), uint16(200))
+		w.message(0, ts(time.Minute), semi(59.94), semi(30.3), uint32((12+500)*5), uint8(0xff), uint16(0xffff))
+		// точка без координат пропускается
+		w.message(0, ts(90*time.Second), int32(0x7fffffff), int32(0x7fffffff), uint32(0xffffffff), uint8(0xff), uint16(0xffff))
+		// точка со сжатым заголовком: время - смещение от предыдущего сообщения
+		w.define(1, fitMsgRecord, [3]byte{fitLat, 4, 0x85}, [3]byte{fitLon, 4, 0x85})
+		w.message(0x80|1<<5|byte((ts(2*time.Minute))&0x1f), semi(59.93), semi(30.3))
+		// круги: время окончания и начала
+		w.define(2, fitMsgLap, [3]byte{fitTimestamp, 4, 0x86}, [3]byte{fitLapStart, 4, 0x86})
+		w.message(2, ts(time.Minute), ts(0))
+		w.message(2, ts(2*time.Minute), ts(time.Minute))
+		trk, err := ParseFIT(bytes.NewReader(w.file()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		points := trk.Points()
+		if len(points) != 3 || trk.Total != 3 {
+			t.Fatalf("%v: точек %d вместо 3", order, len(points))
+		}
+		hr, _ := points[0].HeartRate()
+		pw, _ := points[0].Power()
+		if p := points[0]; math.Abs(p.Lat-59.95) > 1e-6 || !p.Time.Equal(t0) || !p.HasEle || math.Abs(p.Ele-10) > 1e-6 ||
+			hr != 120 || pw != 200 {
+			t.Errorf("%v: первая точка %+v", order, p)
+		}
+		if p := points[1]; p.Ext != "" || math.Abs(p.Ele-12) > 1e-6 {
+			t.Errorf("%v: незаданные пульс и мощность: %+v", order, p)
+		}
+		if p := points[2]; !p.Time.Equal(t0.Add(2*time.Minute)) || p.HasEle {
+			t.Errorf("%v: точка со сжатым заголовком %+v", order, p)
+		}
+		if len(trk.Laps) != 1 || !trk.Laps[0].Equal(t0.Add(time.Minute)) {
+			t.Errorf("%v: круги %v", order, trk.Laps)
+		}
+		if math.Abs(points[1].Dist-1112) > 2 {
+			t.Errorf("%v: расстояние между точками %f", order, points[1].Dist)
+		}
+	}
+	data := (&fitWriter{order: binary.LittleEndian}).file()
+	data[len(data)-1] ^= 0xff
+	if _, err := ParseFIT(bytes.NewReader(data)); err == nil {
+		t.Error("нет ошибки для неверной контрольной суммы")
+	}
+	if _, err := ParseFIT(bytes.NewReader([]byte("<gpx></gpx>"))); err == nil {
+		t.Error("нет ошибки для не FIT-файла")
+	}
+}
@@ -0,0 +1,46 @@
+package track
+
+import "math"
+
+// EarthRadius - средний радиус земли в метрах
+const EarthRadius = 6372795
+
+// Deg2Rad преобразует значение угла из градусов в радианы
+func Deg2Rad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Distance возвращает расстояние в метрах между двумя географическими точками (lat1, lon1) и (lat2, lon2)
+func Distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	dLat := Deg2Rad(lat2 - lat1)
+	dLon := Deg2Rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(Deg2Rad(lat1))*math.Cos(Deg2Rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	dRad := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a)) // дистанция в радианах
+	return EarthRadius * dRad                            // дистанция в метрах
+}
+
+// PointDistance возвращает расстояние в метрах между точками a и b
+func PointDistance(a Point, b Point) float64 {
+	return Distance(a.Lat, a.Lon, b.Lat, b.Lon)
+}
+
+// MaxMercatorLat - предельная широта карты в проекции Web Mercator, при которой карта мира
+// квадратная
+const MaxMercatorLat = 85.0511287798
+
+// Mercator возвращает координаты точки (lat, lon) в проекции Web Mercator: доли ширины и
+// высоты квадратной карты мира от 0 до 1, отсчитываемые от ее левого верхнего угла
+func Mercator(lat float64, lon float64) (x float64, y float64) {
+	lat = math.Max(-MaxMercatorLat, math.Min(MaxMercatorLat, lat))
+	x = (lon + 180) / 360
+	y = (1 - math.Log(math.Tan(Deg2Rad(lat))+1/math.Cos(Deg2Rad(lat)))/math.Pi) / 2
+	return
+}
+
+// InverseMercator возвращает географические координаты точки (x, y) карты мира в проекции
+// Web Mercator, обратная функция к Mercator
+func InverseMercator(x float64, y float64) (lat float64, lon float64) {
+	lon = x*360 - 180
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*y))) * 180 / math.Pi
+	return
+}
@@ -0,0 +1,38 @@
+package track
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tst := func(lat1 float64, lon1 float64, lat2 float64, lon2 float64, goal float64) {
+		d := Distance(lat1, lon1, lat2, lon2)
+		if math.Abs(d-goal) > 1 {
+			t.Fail()
+		}
+	}
+	tst(77.1539, -139.398, -77.1804, -139.55, 17166029)
+	tst(77.1539, 120.398, 77.1804, 129.55, 225883)
+	tst(77.1539, -120.398, 77.1804, 129.55, 2332669)
+}
+
+func TestMercator(t *testing.T) {
+	tst := func(lat float64, lon float64, goalX float64, goalY float64) {
+		x, y := Mercator(lat, lon)
+		if math.Abs(x-goalX) > 1e-9 || math.Abs(y-goalY) > 1e-9 {
+			t.Errorf("Mercator(%v, %v) = %v, %v вместо %v, %v", lat, lon, x, y, goalX, goalY)
+		}
+	}
+	tst(0, 0, 0.5, 0.5)
+	tst(MaxMercatorLat, -180, 0, 0)
+	tst(-90, 180, 1, 1)
+	// тайл 14/9571/4764 содержит точку в Санкт-Петербурге
+	x, y := Mercator(59.93, 30.31)
+	if int(x*(1<<14)) != 9571 || int(y*(1<<14)) != 4764 {
+		t.Errorf("тайл %d/%d", int(x*(1<<14)), int(y*(1<<14)))
+	}
+	if lat, lon := InverseMercator(x, y); math.Abs(lat-59.93) > 1e-9 || math.Abs(lon-30.31) > 1e-9 {
+		t.Errorf("InverseMercator(%v, %v) = %v, %v", x, y, lat, lon)
+	}
+}
@@ -0,0 +1,95 @@
+package track
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Zone - зона приватности: круг с центром (Lat, Lon) и радиусом Radius метров или
+// многоугольник Polygon из точек [широта, долгота]. Точки выхода поездок из круга лежат на
+// окружности, поэтому центр лучше сдвинуть от дома, а радиус взять с запасом
+type Zone struct {
+	Name    string       `json:"name"`    // название зоны для отчетов, например "дом"
+	Lat     float64      `json:"lat"`     // широта центра круга
+	Lon     float64      `json:"lon"`     // долгота центра круга
+	Radius  float64      `json:"radius"`  // радиус круга в метрах
+	Polygon [][2]float64 `json:"polygon"` // вершины многоугольника вместо круга
+}
+
+// Check проверяет, что зона задана кругом или многоугольником
+func (z Zone) Check() error {
+	name := z.Name
+	if name == "" {
+		name = "без названия"
+	}
+	switch {
+	case len(z.Polygon) > 0 && z.Radius > 0:
+		return fmt.Errorf("зона приватности '%s' задана и кругом, и многоугольником", name)
+	case len(z.Polygon) > 0 && len(z.Polygon) < 3:
+		return fmt.Errorf("в многоугольнике зоны приватности '%s' меньше трех вершин", name)
+	case len(z.Polygon) == 0 && z.Radius <= 0:
+		return fmt.Errorf("у зоны приватности '%s' нет ни радиуса, ни многоугольника", name)
+	}
+	return nil
+}
+
+// Contains проверяет, что точка p находится в зоне
+func (z Zone) Contains(p Point) bool {
+	if len(z.Polygon) == 0 {
+		return Distance(z.Lat, z.Lon, p.Lat, p.Lon) <= z.Radius
+	}
+	// луч из точки на восток пересекает стороны многоугольника нечетное число раз
+	in := false
+	for i, j := 0, len(z.Polygon)-1; i < len(z.Polygon); j, i = i, i+1 {
+		a, b := z.Polygon[i], z.Polygon[j]
+		if (a[0] > p.Lat) != (b[0] > p.Lat) && p.Lon < a[1]+(p.Lat-a[0])/(b[0]-a[0])*(b[1]-a[1]) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// timeInName находит в названии трека время суток вида 07:12, 11_58 или 7.12, в том числе
+// внутри даты и времени RFC 3339, и время Unix в секундах
+var timeInName = regexp.MustCompile(`(^|\D)(([01]?\d|2[0-3])[:_.\-hч][0-5]\d|1\d{9})(\D|$)`)
+
+// Privacy удаляет точки в начале и в конце трека, пока они находятся в какой-либо из зон
+// приватности Zones, и запоминает скрытые метры в треке. Ключ поездки после этого - время
+// первой точки вне зон, а не время выезда из дома. Если начало трека скрыто, удаляется и
+// название трека, в котором есть время: устройства называют треки временем выезда в разных
+// форматах, а часы устройства могут расходиться со временем точек, поэтому название
+// удаляется при любом времени в нем
+type Privacy struct {
+	Zones []Zone
+}
+
+func (Privacy) Name() string { return "privacy" }
+
+func (pr Privacy) Process(t *Track) (Report, error) {
+	var r Report
+	inside := func(p Point) bool {
+		for _, z := range pr.Zones {
+			if z.Contains(p) {
+				return true
+			}
+		}
+		return false
+	}
+	points := t.Points()
+	first, last := 0, len(points)-1
+	for first < len(points) && inside(points[first]) {
+		first++
+	}
+	for last >= first && inside(points[last]) {
+		last--
+	}
+	if first >= len(points) {
+		return r, errors.New("весь трек находится в зонах приватности")
+	}
+	r.Removed = t.hideEnds(first, last)
+	if first > 0 && timeInName.MatchString(t.Name) {
+		t.Name = ""
+	}
+	return r, nil
+}
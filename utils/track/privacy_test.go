@@ -0,0 +1,86 @@
+package track
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPrivacy(t *testing.T) {
+	// 21 точка на север через 10 м: дом у начала, работа в многоугольнике у конца
+	points := linePoints(21, 10)
+	trk := FromPoints(points)
+	trk.resetDist()
+	trk.Name = "2021-06-03T14:00:00Z"
+	end := points[20]
+	d := 25.0 / EarthRadius * 180 / math.Pi // 25 м в градусах широты
+	zones := []Zone{
+		{Name: "дом", Lat: points[0].Lat, Lon: points[0].Lon, Radius: 35},
+		{Name: "работа", Polygon: [][2]float64{{end.Lat - d, end.Lon - d}, {end.Lat - d, end.Lon + d}, {end.Lat + d, end.Lon}}},
+	}
+	for _, z := range zones {
+		if err := z.Check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := Privacy{zones}.Process(trk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Removed != 7 || trk.Len() != 14 || trk.Points()[0].Time != points[4].Time {
+		t.Errorf("удалено %d точек, осталось %d", r.Removed, trk.Len())
+	}
+	if trk.Key() == "1622728800" || trk.Name != "" {
+		t.Errorf("ключ %s и название '%s' выдают время выезда", trk.Key(), trk.Name)
+	}
+	s := trk.Stats()
+	if math.Abs(s.HiddenStart-40) > 1e-6 || math.Abs(s.HiddenEnd-30) > 1e-6 || math.Abs(s.Dist-130) > 1e-6 {
+		t.Errorf("скрыто %f и %f м, осталось %f м", s.HiddenStart, s.HiddenEnd, s.Dist)
+	}
+	// скрытые метры сохраняются в json-данных поездки
+	var b bytes.Buffer
+	if err = trk.Encode(&b, JSON); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"hiddenStart":40,"hiddenEnd":30`) {
+		t.Errorf("нет скрытых метров в %s", b.String())
+	}
+	rt, err := DecodeRoute(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.HiddenStart != 40 || rt.HiddenEnd != 30 {
+		t.Errorf("прочитано скрытых метров %f и %f", rt.HiddenStart, rt.HiddenEnd)
+	}
+	if _, err = (Privacy{zones[:1]}).Process(FromPoints(linePoints(3, 10))); err == nil {
+		t.Error("нет ошибки для трека целиком в зоне")
+	}
+	if err = (Zone{Name: "дом"}).Check(); err == nil {
+		t.Error("нет ошибки для зоны без радиуса и многоугольника")
+	}
+}
+
+func TestPrivacyName(t *testing.T) {
+	points := linePoints(21, 10)
+	zones := []Zone{{Name: "дом", Lat: points[0].Lat, Lon: points[0].Lon, Radius: 35}}
+	for name, cleared := range map[string]bool{
+		"2021-06-03T14:00:00Z":                true,
+		"Утренний заезд 2022-04-19T07:12:03Z": true,
+		"19_04_2022_11_58":                    true,
+		"Заезд в 7.12":                        true,
+		"1622728800":                          true,
+		"Вокруг озера":                        false,
+		"Заезд на 40 км":                      false,
+	} {
+		trk := FromPoints(linePoints(21, 10))
+		trk.resetDist()
+		trk.Name = name
+		if _, err := (Privacy{zones}).Process(trk); err != nil {
+			t.Fatal(err)
+		}
+		if (trk.Name == "") != cleared {
+			t.Errorf("название '%s' после скрытия начала: '%s'", name, trk.Name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package track
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// routeData - массивы объекта json-данных поездки
+type routeData struct {
+	ID   string       `json:"id"`
+	LL   [][2]float64 `json:"ll"`
+	DT   []float64    `json:"dt"`
+	DD   []float64    `json:"dd"`
+	EL   []*float64   `json:"el"`
+	HR   []*int       `json:"hr"`
+	PW   []*int       `json:"pw"`
+	Name string       `json:"name"`
+	St   hiddenData   `json:"st"`
+	Laps []Split      `json:"laps"`
+}
+
+// hiddenData - скрытые метры в начале и в конце трека из итогов json-данных поездки
+type hiddenData struct {
+	HiddenStart float64 `json:"hiddenStart"`
+	HiddenEnd   float64 `json:"hiddenEnd"`
+}
+
+// geoJSONData - объект Feature формата GeoJSON
+type geoJSONData struct {
+	Type     string `json:"type"`
+	Geometry struct {
+		Type        string      `json:"type"`
+		Coordinates [][]float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		ID    string     `json:"id"`
+		Name  string     `json:"name"`
+		Start time.Time  `json:"start"`
+		DT    []float64  `json:"dt"`
+		DD    []float64  `json:"dd"`
+		HR    []*int     `json:"hr"`
+		PW    []*int     `json:"pw"`
+		St    hiddenData `json:"st"`
+		Laps  []Split    `json:"laps"`
+	} `json:"properties"`
+}
+
+// DecodeRoute читает трек из json-данных поездки в любом из форматов JS, JSON и GeoJSON,
+// определяя формат по содержимому
+func DecodeRoute(r io.Reader) (*Track, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("tracks[")) {
+		return DecodeJS(bytes.NewReader(data))
+	}
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if err = json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.Type == "Feature" {
+		return DecodeGeoJSON(bytes.NewReader(data))
+	}
+	return DecodeJSON(bytes.NewReader(data))
+}
+
+// DecodeJS читает трек из файла json-данных поездки в формате JS. Время точек
+// восстанавливается по ключу поездки и интервалам dt, расстояния берутся из dd без
+// изменений, поэтому повторная обработка точек не нужна
+func DecodeJS(r io.Reader) (*Track, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	const prefix = "tracks['"
+	end := bytes.Index(data, []byte("']="))
+	if !bytes.HasPrefix(data, []byte(prefix)) || end < 0 {
+		return nil, errors.New("нет объявления tracks['<ключ>']=")
+	}
+	start, err := parseKey(string(data[len(prefix):end]))
+	if err != nil {
+		return nil, err
+	}
+	var rd routeData
+	if err = json.Unmarshal(bytes.TrimSuffix(data[end+3:], []byte(";")), &rd); err != nil {
+		return nil, err
+	}
+	return rd.track(start)
+}
+
+// DecodeJSON читает трек из json-данных поездки в формате JSON
+func DecodeJSON(r io.Reader) (*Track, error) {
+	var rd routeData
+	if err := json.NewDecoder(r).Decode(&rd); err != nil {
+		return nil, err
+	}
+	start, err := parseKey(rd.ID)
+	if err != nil {
+		return nil, err
+	}
+	return rd.track(start)
+}
+
+// DecodeGeoJSON читает трек из json-данных поездки в формате GeoJSON. Время начала берется
+// из свойства start, а если его нет - из ключа поездки
+func DecodeGeoJSON(r io.Reader) (*Track, error) {
+	var gd geoJSONData
+	if err := json.NewDecoder(r).Decode(&gd); err != nil {
+		return nil, err
+	}
+	if gd.Type != "Feature" || gd.Geometry.Type != "LineString" {
+		return nil, fmt.Errorf("ожидается Feature с LineString вместо %s с %s", gd.Type, gd.Geometry.Type)
+	}
+	start := gd.Properties.Start
+	if start.IsZero() {
+		var err error
+		if start, err = parseKey(gd.Properties.ID); err != nil {
+			return nil, err
+		}
+	}
+	coords := gd.Geometry.Coordinates
+	rd := routeData{LL: make([][2]float64, len(coords)), DT: gd.Properties.DT, DD: gd.Properties.DD,
+		HR: gd.Properties.HR, PW: gd.Properties.PW,
+		St: gd.Properties.St, Laps: gd.Properties.Laps}
+	for i, c := range coords {
+		if len(c) < 2 {
+			return nil, fmt.Errorf("в координатах точки %d меньше двух чисел", i)
+		}
+		rd.LL[i] = [2]float64{c[1], c[0]}
+		if len(c) > 2 {
+			if rd.EL == nil {
+				rd.EL = make([]*float64, len(coords))
+			}
+			rd.EL[i] = &c[2]
+		}
+	}
+	t, err := rd.track(start.UTC())
+	if err != nil {
+		return nil, err
+	}
+	t.Name = gd.Properties.Name
+	return t, nil
+}
+
+// parseKey возвращает время начала поездки по ее ключу
+func parseKey(key string) (time.Time, error) {
+	sec, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("неверный ключ поездки '%s'", key)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// track возвращает трек из одного сегмента, первая точка которого имеет время start
+func (rd *routeData) track(start time.Time) (*Track, error) {
+	if len(rd.DT) != len(rd.LL) || len(rd.DD) != len(rd.LL) || (rd.EL != nil && len(rd.EL) != len(rd.LL)) {
+		return nil, fmt.Errorf("разная длина массивов ll, dt, dd и el: %d, %d, %d, %d", len(rd.LL), len(rd.DT), len(rd.DD), len(rd.EL))
+	}
+	if rd.HR != nil && len(rd.HR) != len(rd.LL) {
+		return nil, fmt.Errorf("разная длина массивов ll и hr: %d, %d", len(rd.LL), len(rd.HR))
+	}
+	if rd.PW != nil && len(rd.PW) != len(rd.LL) {
+		return nil, fmt.Errorf("разная длина массивов ll и pw: %d, %d", len(rd.LL), len(rd.PW))
+	}
+	if len(rd.LL) < 1 {
+		return nil, ErrEmpty
+	}
+	points := make([]Point, len(rd.LL))
+	var offset float64
+	for i, ll := range rd.LL {
+		offset += rd.DT[i]
+		points[i] = Point{
+			Lat:  ll[0],
+			Lon:  ll[1],
+			Time: start.Add(time.Duration(math.Round(offset * float64(time.Second)))),
+			Dist: rd.DD[i],
+		}
+		if rd.EL != nil && rd.EL[i] != nil {
+			points[i].Ele, points[i].HasEle = *rd.EL[i], true
+		}
+		if rd.HR != nil && rd.HR[i] != nil {
+			points[i].Ext = hrExt(*rd.HR[i])
+		}
+		if rd.PW != nil && rd.PW[i] != nil {
+			points[i].Ext += powerExt(*rd.PW[i])
+		}
+	}
+	t := FromPoints(points)
+	if rd.HR != nil {
+		t.Namespaces = map[string]string{"gpxtpx": tpxNamespace}
+	}
+	t.Name = rd.Name
+	t.HiddenStart, t.HiddenEnd = rd.St.HiddenStart, rd.St.HiddenEnd
+	for i, lap := range rd.Laps {
+		if i > 0 {
+			t.Laps = append(t.Laps, start.Add(time.Duration(math.Round(lap.Start*float64(time.Second)))))
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,132 @@
+package track
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// randomTrack - случайный трек для проверки чтения json-данных поездок
+type randomTrack struct {
+	*Track
+}
+
+func (randomTrack) Generate(r *rand.Rand, size int) reflect.Value {
+	points := make([]Point, 1+r.Intn(size+1))
+	lat, lon, ele := r.Float64()*170-85, r.Float64()*360-180, r.Float64()*3000
+	withEle, withHR, withPW := r.Intn(2) == 0, r.Intn(2) == 0, r.Intn(2) == 0
+	t := time.Unix(1600000000+r.Int63n(200000000), 0).UTC()
+	for i := range points {
+		if i > 0 {
+			lat += r.NormFloat64() * 1e-4
+			lon += r.NormFloat64() * 1e-4
+			t = t.Add(time.Duration(1+r.Intn(30)) * time.Second)
+		}
+		points[i] = Point{Lat: lat, Lon: lon, Time: t, Dist: r.Float64() * 50}
+		if withEle && r.Intn(10) > 0 { // у некоторых точек высота неизвестна
+			ele += r.NormFloat64() * 3
+			points[i].Ele, points[i].HasEle = ele, true
+		}
+		if withHR && r.Intn(10) > 0 { // пульс и мощность тоже известны не у всех точек
+			points[i].Ext = hrExt(60 + r.Intn(140))
+		}
+		if withPW && r.Intn(10) > 0 {
+			points[i].Ext += powerExt(r.Intn(1000))
+		}
+	}
+	points[0].Dist = 0
+	return reflect.ValueOf(randomTrack{FromPoints(points)})
+}
+
+// sameInt проверяет, что значения got и want одновременно неизвестны или совпадают
+func sameInt(got, want func() (int, bool)) bool {
+	g, gok := got()
+	w, wok := want()
+	return gok == wok && g == w
+}
+
+// roundTrip записывает трек в формате f и читает его обратно
+func roundTrip(trk *Track, f Format) (*Track, []byte, error) {
+	var buf bytes.Buffer
+	if err := trk.Encode(&buf, f); err != nil {
+		return nil, nil, err
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+	res, err := DecodeRoute(&buf)
+	return res, data, err
+}
+
+// TestRouteRoundTrip проверяет, что прочитанный трек совпадает с записанным с точностью
+// формата и что повторная запись прочитанного трека дает те же данные
+func TestRouteRoundTrip(t *testing.T) {
+	for _, f := range []Format{JS, JSON, GeoJSON} {
+		for _, prec := range []Precision{DefaultPrecision, {LL: 5, DT: 1, DD: 1}, {LL: 3, DD: 0}} {
+			f.Precision = prec
+			check := func(rt randomTrack) bool {
+				res, data, err := roundTrip(rt.Track, f)
+				if err != nil {
+					t.Logf("%s: %s", f.Name, err.Error())
+					return false
+				}
+				got, want := res.Points(), rt.Points()
+				if len(got) != len(want) || res.Key() != rt.Key() {
+					return false
+				}
+				llTol, ddTol, elTol := 0.5*math.Pow10(-prec.LL)+1e-12, 0.5*math.Pow10(-prec.DD)+1e-9, 0.5*math.Pow10(-prec.EL)+1e-9
+				for i := range want {
+					if !got[i].Time.Equal(want[i].Time) || math.Abs(got[i].Lat-want[i].Lat) > llTol ||
+						math.Abs(got[i].Lon-want[i].Lon) > llTol || math.Abs(got[i].Dist-want[i].Dist) > ddTol ||
+						got[i].HasEle != want[i].HasEle || math.Abs(got[i].Ele-want[i].Ele) > elTol ||
+						!sameInt(got[i].HeartRate, want[i].HeartRate) || !sameInt(got[i].Power, want[i].Power) {
+						t.Logf("%s: точка %d: %+v вместо %+v", f.Name, i, got[i], want[i])
+						return false
+					}
+				}
+				_, again, err := roundTrip(res, f)
+				return err == nil && bytes.Equal(again, data)
+			}
+			if err := quick.Check(check, nil); err != nil {
+				t.Errorf("%s %v: %s", f.Name, prec, err.Error())
+			}
+		}
+	}
+}
+
+// TestRouteFileRoundTrip проверяет повторную запись json-данных поездки, полученных из GPX-файла
+func TestRouteFileRoundTrip(t *testing.T) {
+	trk, err := Decode(strings.NewReader(xml1), DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []Format{JS, JSON, GeoJSON} {
+		res, data, err := roundTrip(trk, f)
+		if err != nil {
+			t.Fatalf("%s: %s", f.Name, err.Error())
+		}
+		if _, again, _ := roundTrip(res, f); !bytes.Equal(again, data) {
+			t.Errorf("%s: данные изменились:\n%s\n%s", f.Name, data, again)
+		}
+	}
+}
+
+func TestDecodeJS(t *testing.T) {
+	trk, err := DecodeJS(strings.NewReader(`tracks['1622728859']={"ll":[[59.9,30.2],[59.91,30.21]],"dt":[0,2],"dd":[0,1250.5]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := trk.Points()
+	if len(points) != 2 || points[1].Lon != 30.21 || points[1].Dist != 1250.5 || trk.Key() != "1622728859" ||
+		points[1].Time.Sub(points[0].Time).Seconds() != 2 {
+		t.Errorf("неверные точки %+v", points)
+	}
+	for _, data := range []string{`{"ll":[]}`, `tracks['x']={}`, `tracks['1']={"ll":[[1,2]],"dt":[0],"dd":[]}`, `tracks['1']={"ll":[],"dt":[],"dd":[]}`} {
+		if _, err = DecodeJS(strings.NewReader(data)); err == nil {
+			t.Errorf("нет ошибки для %s", data)
+		}
+	}
+}
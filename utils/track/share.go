@@ -0,0 +1,68 @@
+package track
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ShareOptions - параметры обезличивания трека для публикации
+type ShareOptions struct {
+	Jitter float64    // наибольший случайный сдвиг трека в метрах, 0 - без сдвига
+	Digits int        // количество знаков после запятой, до которого отбрасываются координаты, 0 - без отбрасывания
+	Rand   *rand.Rand // источник случайных сдвигов, nil - по текущему времени
+}
+
+// ShareEpoch - время начала обезличенного трека, от которого отсчитывается время точек
+var ShareEpoch = time.Unix(0, 0).UTC()
+
+// Share возвращает обезличенную копию трека для публикации: время точек отсчитывается от
+// ShareEpoch и округляется до секунды, название, пространства имен, расширения точек с
+// данными датчиков и скрытые метры удаляются, координаты по параметрам opts сдвигаются
+// все вместе на одно случайное расстояние, чтобы форма трека не менялась, и отбрасываются
+// до заданного количества знаков. Расстояния между точками отсчитываются по прямой по
+// исходным координатам, поэтому сдвиг и отбрасывание знаков не меняют итогов поездки.
+// Время начала кругов отсчитывается от ShareEpoch. По копии нельзя узнать время исходной поездки
+func (t *Track) Share(opts ShareOptions) *Track {
+	var north, east float64 // сдвиг трека в метрах
+	if opts.Jitter > 0 {
+		rnd := opts.Rand
+		if rnd == nil {
+			rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		// равномерно по площади круга радиусом Jitter
+		r, a := opts.Jitter*math.Sqrt(rnd.Float64()), 2*math.Pi*rnd.Float64()
+		north, east = r*math.Cos(a), r*math.Sin(a)
+	}
+	start := t.Start()
+	res := &Track{}
+	var prev *Point
+	for _, s := range t.Segments {
+		points := make([]Point, len(s.Points))
+		for i, p := range s.Points {
+			lat := p.Lat + north/EarthRadius*180/math.Pi
+			lon := p.Lon + east/(EarthRadius*math.Cos(Deg2Rad(p.Lat)))*180/math.Pi
+			if opts.Digits > 0 {
+				m := math.Pow(10, float64(opts.Digits))
+				lat, lon = math.Trunc(lat*m)/m, math.Trunc(lon*m)/m
+			}
+			points[i] = Point{
+				Lat:    lat,
+				Lon:    lon,
+				Time:   ShareEpoch.Add(p.Time.Sub(start).Round(time.Second)),
+				Ele:    p.Ele,
+				HasEle: p.HasEle,
+			}
+			if prev != nil {
+				points[i].Dist = PointDistance(*prev, p)
+			}
+			prev = &s.Points[i]
+		}
+		res.Segments = append(res.Segments, Segment{Points: points})
+	}
+	for _, lap := range t.Laps {
+		res.Laps = append(res.Laps, ShareEpoch.Add(lap.Sub(start).Round(time.Second)))
+	}
+	res.Total = res.Len()
+	return res
+}
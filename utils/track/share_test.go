@@ -0,0 +1,67 @@
+package track
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	points := linePoints(21, 10)
+	for i := range points {
+		points[i].Ext = "<gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr></gpxtpx:TrackPointExtension>"
+	}
+	trk := FromPoints(points)
+	trk.resetDist()
+	trk.Name = "Утренняя поездка"
+	trk.Namespaces = map[string]string{"gpxtpx": "http://www.garmin.com/xmlschemas/TrackPointExtension/v1"}
+	trk.HiddenStart = 300
+	shared := trk.Share(ShareOptions{Jitter: 10, Digits: 4, Rand: rand.New(rand.NewSource(1))})
+	if shared.Start() != ShareEpoch || shared.Key() != "0" || shared.End().Sub(shared.Start()) != trk.End().Sub(trk.Start()) {
+		t.Errorf("время обезличенного трека %s - %s", shared.Start(), shared.End())
+	}
+	if trk.Start() == ShareEpoch || trk.Points()[0].Ext == "" {
+		t.Error("изменен исходный трек")
+	}
+	for i, p := range shared.Points() {
+		// сдвиг до 10 м и отбрасывание знаков до 0,0001° - примерно до 11 м по широте
+		if d := PointDistance(p, points[i]); d > 25 {
+			t.Errorf("точка %d сдвинута на %.1f м", i, d)
+		}
+		if p.Ext != "" {
+			t.Errorf("у точки %d остались расширения", i)
+		}
+		if p.Dist != points[i].Dist {
+			t.Errorf("расстояние точки %d %.2f м вместо %.2f м", i, p.Dist, points[i].Dist)
+		}
+	}
+	// весь трек сдвигается на одно и то же расстояние
+	moved := trk.Share(ShareOptions{Jitter: 10, Rand: rand.New(rand.NewSource(2))}).Points()
+	shift := PointDistance(moved[0], points[0])
+	if shift == 0 {
+		t.Error("трек не сдвинут")
+	}
+	for i, p := range moved {
+		if math.Abs(p.Lat-points[i].Lat-(moved[0].Lat-points[0].Lat)) > 1e-9 || math.Abs(PointDistance(p, points[i])-shift) > 0.01 {
+			t.Errorf("точка %d сдвинута иначе, чем первая", i)
+		}
+	}
+	var b bytes.Buffer
+	if err := shared.Encode(&b, GPX); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"2021", "Утренняя", "gpxtpx", "hr>"} {
+		if strings.Contains(b.String(), s) {
+			t.Errorf("в обезличенном GPX есть '%s'", s)
+		}
+	}
+	b.Reset()
+	if err := shared.Encode(&b, GeoJSON); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "2021") || strings.Contains(b.String(), "hidden") {
+		t.Errorf("в обезличенном GeoJSON есть время или скрытые метры поездки: %s", b.String())
+	}
+}
@@ -0,0 +1,162 @@
+package track
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Split - отрезок разбивки поездки по расстоянию или по кругам
+type Split struct {
+	Start  float64 `json:"start"`         // время начала отрезка от начала поездки в секундах
+	Dist   float64 `json:"dist"`          // длина отрезка в метрах
+	Time   float64 `json:"time"`          // продолжительность отрезка в секундах вместе с остановками
+	Speed  float64 `json:"speed"`         // средняя скорость на отрезке в км/ч
+	HasEle bool    `json:"-"`             // высоты начала и конца отрезка известны
+	Ele    float64 `json:"ele,omitempty"` // изменение высоты от начала до конца отрезка в метрах
+	HR     float64 `json:"hr,omitempty"`  // средний пульс в точках отрезка, 0 - неизвестен
+}
+
+// splitPoint - точка трека с временем и расстоянием от начала поездки
+type splitPoint struct {
+	time, dist, ele float64
+	hasEle          bool
+	hr              int     // пульс, 0 - неизвестен
+	work            float64 // работа от начала поездки в джоулях по мощности точек
+}
+
+// splitPoints возвращает точки трека с временем и расстоянием от начала поездки
+func (t *Track) splitPoints() []splitPoint {
+	points := t.Points()
+	res := make([]splitPoint, len(points))
+	var dist, work float64
+	for i, p := range points {
+		dist += p.Dist
+		sec := p.Time.Sub(points[0].Time).Seconds()
+		// мощность точки действует на интервале от предыдущей точки
+		if pw, ok := p.Power(); ok && i > 0 {
+			work += float64(pw) * (sec - res[i-1].time)
+		}
+		res[i] = splitPoint{time: sec, dist: dist, ele: p.Ele, hasEle: p.HasEle, work: work}
+		res[i].hr, _ = p.HeartRate()
+	}
+	return res
+}
+
+// byDist и byTime возвращают расстояние и время точки от начала поездки
+func byDist(p splitPoint) float64 { return p.dist }
+
+func byTime(p splitPoint) float64 { return p.time }
+
+// interpolate возвращает промежуточную точку между a и b в доле f от a
+func interpolate(a splitPoint, b splitPoint, f float64) splitPoint {
+	m := splitPoint{time: a.time + (b.time-a.time)*f, dist: a.dist + (b.dist-a.dist)*f, work: a.work + (b.work-a.work)*f}
+	if a.hasEle && b.hasEle {
+		m.ele, m.hasEle = a.ele+(b.ele-a.ele)*f, true
+	}
+	return m
+}
+
+// split разбивает точки на отрезки по возрастающим границам bounds величины key: времени
+// или расстояния от начала поездки. Точки на границах отрезков интерполируются, последний
+// отрезок заканчивается последней точкой трека
+func split(points []splitPoint, key func(p splitPoint) float64, bounds []float64) []Split {
+	if len(points) < 2 {
+		return nil
+	}
+	var res []Split
+	start := points[0]
+	var hrSum, hrCount int
+	addHR := func(p splitPoint) {
+		if p.hr > 0 {
+			hrSum, hrCount = hrSum+p.hr, hrCount+1
+		}
+	}
+	addHR(start)
+	add := func(end splitPoint) {
+		s := Split{Start: start.time, Dist: end.dist - start.dist, Time: end.time - start.time}
+		if s.Time > 0 {
+			s.Speed = 3.6 * s.Dist / s.Time
+		}
+		if start.hasEle && end.hasEle {
+			s.HasEle, s.Ele = true, end.ele-start.ele
+		}
+		if hrCount > 0 {
+			s.HR = float64(hrSum) / float64(hrCount)
+		}
+		res = append(res, s)
+		start, hrSum, hrCount = end, 0, 0
+	}
+	var bi int
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		// пульс точки на границе относится к отрезку, который она заканчивает
+		inCurrent := bi >= len(bounds) || key(b) <= bounds[bi]
+		if inCurrent {
+			addHR(b)
+		}
+		for bi < len(bounds) && key(b) >= bounds[bi] {
+			f := 1.0
+			if key(b) > key(a) {
+				f = math.Max(0, (bounds[bi]-key(a))/(key(b)-key(a)))
+			}
+			add(interpolate(a, b, f))
+			bi++
+		}
+		if !inCurrent {
+			addHR(b)
+		}
+	}
+	if last := points[len(points)-1]; key(last) > key(start) {
+		add(last)
+	}
+	return res
+}
+
+// Splits возвращает разбивку поездки на отрезки по step метров, последний отрезок может быть
+// короче. Расстояния берутся из сглаженных расстояний точек Point.Dist
+func (t *Track) Splits(step float64) []Split {
+	points := t.splitPoints()
+	if len(points) < 2 || step <= 0 {
+		return nil
+	}
+	var bounds []float64
+	for d := step; d < points[len(points)-1].dist; d += step {
+		bounds = append(bounds, d)
+	}
+	return split(points, byDist, bounds)
+}
+
+// LapSplits возвращает разбивку поездки по кругам Laps или nil, если кругов нет
+func (t *Track) LapSplits() []Split {
+	points := t.splitPoints()
+	var bounds []float64
+	for _, lap := range t.Laps {
+		if sec := lap.Sub(t.Start()).Seconds(); sec > 0 && len(points) > 0 && sec < points[len(points)-1].time {
+			bounds = append(bounds, sec)
+		}
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	return split(points, byTime, bounds)
+}
+
+// writeSplits записывает массив name отрезков разбивки поездки
+func writeSplits(w io.Writer, name string, splits []Split, prec Precision) {
+	fmt.Fprintf(w, "\"%s\":[", name)
+	for i, s := range splits {
+		if i > 0 {
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprintf(w, "{\"start\":%.*f,\"dist\":%.*f,\"time\":%.*f,\"speed\":%.2f", prec.DT, s.Start, prec.DD, s.Dist, prec.DT, s.Time, s.Speed)
+		if s.HasEle {
+			fmt.Fprintf(w, ",\"ele\":%.*f", prec.EL, s.Ele)
+		}
+		if s.HR > 0 {
+			fmt.Fprintf(w, ",\"hr\":%.0f", s.HR)
+		}
+		fmt.Fprint(w, "}")
+	}
+	fmt.Fprint(w, "]")
+}
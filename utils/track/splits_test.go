@@ -0,0 +1,97 @@
+package track
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplits(t *testing.T) {
+	// 26 точек на север через 10 м раз в секунду: 250 м за 25 с
+	points := linePoints(26, 10)
+	for i := range points {
+		points[i].Ele, points[i].HasEle = float64(i), true
+	}
+	trk := FromPoints(points)
+	trk.resetDist()
+	splits := trk.Splits(100)
+	if len(splits) != 3 {
+		t.Fatalf("%d отрезков вместо 3: %v", len(splits), splits)
+	}
+	for i, want := range []Split{{0, 100, 10, 36, true, 10, 0}, {10, 100, 10, 36, true, 10, 0}, {20, 50, 5, 36, true, 5, 0}} {
+		s := splits[i]
+		if math.Abs(s.Start-want.Start) > 1e-6 || math.Abs(s.Dist-want.Dist) > 1e-6 || math.Abs(s.Time-want.Time) > 1e-6 ||
+			math.Abs(s.Speed-want.Speed) > 1e-6 || !s.HasEle || math.Abs(s.Ele-want.Ele) > 1e-6 {
+			t.Errorf("отрезок %d: %+v вместо %+v", i, s, want)
+		}
+	}
+	if trk.LapSplits() != nil {
+		t.Error("разбивка по кругам без кругов")
+	}
+	trk.Laps = []time.Time{points[0].Time.Add(15 * time.Second)}
+	laps := trk.LapSplits()
+	if len(laps) != 2 || math.Abs(laps[0].Dist-150) > 1e-6 || math.Abs(laps[1].Start-15) > 1e-6 || math.Abs(laps[1].Dist-100) > 1e-6 {
+		t.Errorf("круги %+v", laps)
+	}
+	// круги сохраняются в json-данных поездки
+	var b bytes.Buffer
+	f := JSON
+	f.Splits = 100
+	if err := trk.Encode(&b, f); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"splits":[{"start":0,"dist":100.00,"time":10,"speed":36.00,"ele":10.0}`) {
+		t.Errorf("нет разбивки в %s", b.String())
+	}
+	rt, err := DecodeRoute(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Laps) != 1 || !rt.Laps[0].Equal(trk.Laps[0]) {
+		t.Errorf("прочитаны круги %v", rt.Laps)
+	}
+}
+
+func TestParseLaps(t *testing.T) {
+	tcx := `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"><Activities><Activity Sport="Biking">
+<Lap StartTime="2021-06-03T14:00:00Z"><Track>
+<Trackpoint><Time>2021-06-03T14:00:00Z</Time><Position><LatitudeDegrees>59.9</LatitudeDegrees><LongitudeDegrees>30.25</LongitudeDegrees></Position><AltitudeMeters>5</AltitudeMeters><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint>
+<Trackpoint><Time>2021-06-03T14:00:10Z</Time><Position><LatitudeDegrees>59.901</LatitudeDegrees><LongitudeDegrees>30.25</LongitudeDegrees></Position><AltitudeMeters>6</AltitudeMeters><HeartRateBpm><Value>130</Value></HeartRateBpm>
+<Extensions><TPX xmlns="http://www.garmin.com/xmlschemas/ActivityExtension/v2"><Watts>200</Watts></TPX></Extensions></Trackpoint>
+</Track></Lap>
+<Lap StartTime="2021-06-03T14:00:10Z"><Track>
+<Trackpoint><Time>2021-06-03T14:00:10Z</Time></Trackpoint>
+<Trackpoint><Time>2021-06-03T14:00:20Z</Time><Position><LatitudeDegrees>59.902</LatitudeDegrees><LongitudeDegrees>30.25</LongitudeDegrees></Position><HeartRateBpm><Value>140</Value></HeartRateBpm></Trackpoint>
+</Track></Lap>
+</Activity></Activities></TrainingCenterDatabase>`
+	trk, err := ParseTCX(strings.NewReader(tcx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Len() != 3 || len(trk.Segments) != 2 || len(trk.Laps) != 1 {
+		t.Fatalf("%d точек, %d сегментов, круги %v", trk.Len(), len(trk.Segments), trk.Laps)
+	}
+	p := trk.Points()[1]
+	if hr, ok := p.HeartRate(); !ok || hr != 130 || !strings.Contains(p.Ext, "<power>200</power>") || !p.HasEle || p.Ele != 6 {
+		t.Errorf("точка %+v", p)
+	}
+	laps := trk.LapSplits()
+	if len(laps) != 2 || laps[0].Time != 10 || laps[0].HR != 125 || laps[1].HR != 140 {
+		t.Errorf("круги %+v", laps)
+	}
+	// отметка круга путевой точкой GPX-файла
+	gpx := `<gpx version="1.1"><wpt lat="59.901" lon="30.25"><time>2021-06-03T14:00:10Z</time><type>lap</type></wpt>
+<wpt lat="59.9" lon="30.25"><name>кафе</name></wpt>
+<trk><trkseg><trkpt lat="59.9" lon="30.25"><time>2021-06-03T14:00:00Z</time></trkpt>
+<trkpt lat="59.901" lon="30.25"><time>2021-06-03T14:00:10Z</time></trkpt>
+<trkpt lat="59.902" lon="30.25"><time>2021-06-03T14:00:20Z</time></trkpt></trkseg></trk></gpx>`
+	if trk, err = Parse(strings.NewReader(gpx)); err != nil {
+		t.Fatal(err)
+	}
+	if len(trk.Laps) != 1 || !trk.Laps[0].Equal(time.Date(2021, 6, 3, 14, 0, 10, 0, time.UTC)) {
+		t.Errorf("круги %v", trk.Laps)
+	}
+}
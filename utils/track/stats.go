@@ -0,0 +1,160 @@
+package track
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Пороги отбора скоростей движения, такие же, как на странице сайта
+const (
+	MinMovingSpeed  = 8 / 3.6  // минимальная скорость для учета движения в м/с
+	MaxMovingSpeed  = 60 / 3.6 // максимальная скорость для учета движения в м/с
+	MaxAcceleration = 4 / 3.6  // максимальное ускорение в м/с2
+)
+
+// EleThreshold - изменение высоты в метрах, меньше которого колебания не учитываются в
+// наборе и сбросе высоты
+const EleThreshold = 2
+
+// Stats - итоги поездки
+type Stats struct {
+	Dist     float64    `json:"dist"`     // расстояние в метрах
+	Elapsed  float64    `json:"elapsed"`  // время от первой до последней точки в секундах
+	Moving   float64    `json:"moving"`   // время движения в секундах
+	AvgSpeed float64    `json:"avgSpeed"` // средняя скорость движения в км/ч
+	MaxSpeed float64    `json:"maxSpeed"` // максимальная скорость движения в км/ч
+	HasEle   bool       `json:"hasEle"`   // высоты известны и набор и сброс высоты посчитаны
+	Gain     float64    `json:"gain"`     // набор высоты в метрах
+	Loss     float64    `json:"loss"`     // сброс высоты в метрах
+	BBox     [4]float64 `json:"bbox"`     // границы трека: минимальные широта и долгота, максимальные широта и долгота
+	Start    [2]float64 `json:"start"`    // широта и долгота первой точки
+	End      [2]float64 `json:"end"`      // широта и долгота последней точки
+	// HiddenStart и HiddenEnd - скрытые при обработке метры в начале и в конце трека
+	HiddenStart float64 `json:"hiddenStart,omitempty"`
+	HiddenEnd   float64 `json:"hiddenEnd,omitempty"`
+}
+
+// speedFilter отбирает скорости движения так же, как SpeedFilter на странице сайта:
+// скорость отбрасывается, если она вне пределов или ускорение до нее слишком велико
+type speedFilter struct {
+	prevTime  float64
+	prevSpeed float64
+}
+
+// validate проверяет скорость speed в момент time секунд от начала поездки
+func (f *speedFilter) validate(time float64, speed float64) bool {
+	var acceleration float64
+	if f.prevTime > 0 {
+		if dt := time - f.prevTime; dt > 0 {
+			acceleration = (speed - f.prevSpeed) / dt
+		}
+	}
+	if acceleration < MaxAcceleration && speed < MaxMovingSpeed {
+		f.prevTime = time
+		f.prevSpeed = speed
+	}
+	return acceleration < MaxAcceleration && speed > MinMovingSpeed && speed < MaxMovingSpeed
+}
+
+// Speed - скорость на отрезке трека от предыдущей точки
+type Speed struct {
+	Elapsed float64 // время точки от начала поездки в секундах
+	Dist    float64 // расстояние точки от начала поездки в метрах
+	Speed   float64 // скорость на отрезке в км/ч
+	Moving  bool    // скорость прошла отбор speedFilter и учитывается в итогах поездки
+
+	dt float64 // длительность отрезка в секундах
+	dd float64 // длина отрезка в метрах
+}
+
+// Speeds возвращает скорости на всех отрезках трека с ненулевой длительностью, отмечая
+// скорости движения так же, как при подсчете итогов поездки
+func (t *Track) Speeds() []Speed {
+	points := t.Points()
+	var res []Speed
+	var dist, time float64
+	var filter speedFilter
+	for i, p := range points {
+		dist += p.Dist
+		if i == 0 {
+			continue
+		}
+		dt := p.Time.Sub(points[i-1].Time).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		time += dt
+		speed := p.Dist / dt
+		res = append(res, Speed{
+			Elapsed: p.Time.Sub(points[0].Time).Seconds(),
+			Dist:    dist,
+			Speed:   3.6 * speed,
+			Moving:  filter.validate(time, speed),
+			dt:      dt,
+			dd:      p.Dist,
+		})
+	}
+	return res
+}
+
+// Stats возвращает итоги поездки. Время и скорость движения считаются только по отрезкам,
+// скорость на которых прошла отбор speedFilter
+func (t *Track) Stats() Stats {
+	s := Stats{HiddenStart: t.HiddenStart, HiddenEnd: t.HiddenEnd}
+	points := t.Points()
+	if len(points) < 1 {
+		return s
+	}
+	first, last := points[0], points[len(points)-1]
+	s.Elapsed = last.Time.Sub(first.Time).Seconds()
+	s.Start = [2]float64{first.Lat, first.Lon}
+	s.End = [2]float64{last.Lat, last.Lon}
+	s.BBox = [4]float64{first.Lat, first.Lon, first.Lat, first.Lon}
+	var ele float64 // высота, от которой отсчитывается следующее изменение
+	for _, p := range points {
+		s.Dist += p.Dist
+		s.BBox[0] = math.Min(s.BBox[0], p.Lat)
+		s.BBox[1] = math.Min(s.BBox[1], p.Lon)
+		s.BBox[2] = math.Max(s.BBox[2], p.Lat)
+		s.BBox[3] = math.Max(s.BBox[3], p.Lon)
+		if p.HasEle {
+			if !s.HasEle {
+				s.HasEle, ele = true, p.Ele
+			} else if d := p.Ele - ele; d >= EleThreshold {
+				s.Gain += d
+				ele = p.Ele
+			} else if d <= -EleThreshold {
+				s.Loss -= d
+				ele = p.Ele
+			}
+		}
+	}
+	var movingDist float64
+	for _, sp := range t.Speeds() {
+		if sp.Moving {
+			movingDist += sp.dd
+			s.Moving += sp.dt
+			s.MaxSpeed = math.Max(s.MaxSpeed, sp.Speed)
+		}
+	}
+	if s.Moving > 0 {
+		s.AvgSpeed = 3.6 * movingDist / s.Moving
+	}
+	return s
+}
+
+// writeStats записывает итоги поездки json-объектом с полем name
+func writeStats(w io.Writer, name string, s Stats, prec Precision) {
+	fmt.Fprintf(w, "\"%s\":{\"dist\":%.*f,\"elapsed\":%.0f,\"moving\":%.0f,\"avgSpeed\":%.2f,\"maxSpeed\":%.2f,",
+		name, prec.DD, s.Dist, s.Elapsed, s.Moving, s.AvgSpeed, s.MaxSpeed)
+	if s.HasEle {
+		fmt.Fprintf(w, "\"gain\":%.0f,\"loss\":%.0f,", s.Gain, s.Loss)
+	}
+	fmt.Fprintf(w, "\"bbox\":[%.*f,%.*f,%.*f,%.*f],", prec.LL, s.BBox[0], prec.LL, s.BBox[1], prec.LL, s.BBox[2], prec.LL, s.BBox[3])
+	fmt.Fprintf(w, "\"start\":[%.*f,%.*f],\"end\":[%.*f,%.*f]", prec.LL, s.Start[0], prec.LL, s.Start[1], prec.LL, s.End[0], prec.LL, s.End[1])
+	if s.HiddenStart > 0 || s.HiddenEnd > 0 {
+		fmt.Fprintf(w, ",\"hiddenStart\":%.0f,\"hiddenEnd\":%.0f", s.HiddenStart, s.HiddenEnd)
+	}
+	fmt.Fprint(w, "}")
+}
@@ -0,0 +1,37 @@
+package track
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	// 10 точек через 3 м и секунду и последняя точка через 1 м и 10 секунд
+	points := linePoints(11, 3)
+	points[10] = linePoints(10, 3)[9]
+	points[10].Lat += 1.0 / EarthRadius * 180 / math.Pi
+	points[10].Time = points[9].Time.Add(10 * time.Second)
+	eles := []float64{100, 101, 103, 104, 103.5, 106, 105, 102, 101.5, 101, 99}
+	for i := range points {
+		points[i].Ele, points[i].HasEle = eles[i], true
+	}
+	trk := FromPoints(points)
+	trk.resetDist()
+	s := trk.Stats()
+	if math.Abs(s.Dist-28) > 1e-6 || s.Elapsed != 19 || s.Moving != 9 {
+		t.Errorf("неверные расстояние и время: %+v", s)
+	}
+	if math.Abs(s.AvgSpeed-10.8) > 1e-6 || math.Abs(s.MaxSpeed-10.8) > 1e-6 {
+		t.Errorf("неверные скорости: %+v", s)
+	}
+	if !s.HasEle || s.Gain != 6 || s.Loss != 7 {
+		t.Errorf("неверные набор и сброс высоты: %+v", s)
+	}
+	if s.Start != [2]float64{points[0].Lat, points[0].Lon} || s.BBox[2] != points[10].Lat || s.BBox[1] != s.BBox[3] {
+		t.Errorf("неверные границы: %+v", s)
+	}
+	if s := FromPoints(points[:1]).Stats(); s.Elapsed != 0 || s.Moving != 0 || s.AvgSpeed != 0 {
+		t.Errorf("неверные итоги трека из одной точки: %+v", s)
+	}
+}
@@ -0,0 +1,104 @@
+package track
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// tpxNamespace - пространство имен расширения точек Garmin, в котором пульс точек TCX-файла
+// записывается в расширения точек так же, как в GPX-файлах
+const tpxNamespace = "http://www.garmin.com/xmlschemas/TrackPointExtension/v1"
+
+// tcxPoint - элемент Trackpoint TCX-файла
+type tcxPoint struct {
+	Time     time.Time `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lon float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Alt *float64 `xml:"AltitudeMeters"`
+	HR  *struct {
+		Value int `xml:"Value"`
+	} `xml:"HeartRateBpm"`
+	Watts *int `xml:"Extensions>TPX>Watts"`
+}
+
+// hrExt возвращает расширение точки с пульсом hr ударов в минуту
+func hrExt(hr int) string {
+	return fmt.Sprintf("<gpxtpx:TrackPointExtension><gpxtpx:hr>%d</gpxtpx:hr></gpxtpx:TrackPointExtension>", hr)
+}
+
+// powerExt возвращает расширение точки с мощностью pw ватт
+func powerExt(pw int) string {
+	return fmt.Sprintf("<power>%d</power>", pw)
+}
+
+// ParseTCX читает трек из TCX-данных без какой-либо обработки точек так же, как Parse.
+// Каждый элемент Track становится сегментом, время начала кругов Lap после первого - кругами
+// трека, пульс и мощность записываются в расширения точек. Точки без координат пропускаются
+func ParseTCX(r io.Reader) (*Track, error) {
+	t := &Track{}
+	var f flat
+	var seg int
+	var laps []time.Time
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "Lap":
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "StartTime" {
+					lap, err := time.Parse(time.RFC3339, attr.Value)
+					if err != nil {
+						return nil, fmt.Errorf("время начала круга: %s", err.Error())
+					}
+					laps = append(laps, lap.UTC())
+				}
+			}
+		case "Track":
+			seg++
+		case "Trackpoint":
+			var tp tcxPoint
+			if err := d.DecodeElement(&tp, &start); err != nil {
+				return nil, err
+			}
+			if tp.Position == nil {
+				continue
+			}
+			p := Point{Lat: tp.Position.Lat, Lon: tp.Position.Lon, Time: tp.Time.UTC()}
+			if tp.Alt != nil {
+				p.Ele, p.HasEle = *tp.Alt, true
+			}
+			if tp.HR != nil && tp.HR.Value > 0 {
+				p.Ext = hrExt(tp.HR.Value)
+				t.Namespaces = map[string]string{"gpxtpx": tpxNamespace}
+			}
+			if tp.Watts != nil {
+				p.Ext += powerExt(*tp.Watts)
+			}
+			f.add(p, seg)
+		}
+	}
+	f.apply(t)
+	t.Total = t.Len()
+	t.resetDist()
+	for _, lap := range laps {
+		if lap.After(t.Start()) {
+			t.Laps = append(t.Laps, lap)
+		}
+	}
+	sortLaps(t)
+	return t, nil
+}
@@ -0,0 +1,126 @@
+// Package track читает GPX-треки велопоездок, отбрасывает выбросы, сглаживает расстояния
+// между точками и записывает треки в формате json-данных поездок сайта.
+//
+// Точки трека хранятся по сегментам в том порядке, в котором они записаны в файле.
+// Расстояние Point.Dist каждой точки отсчитывается от предыдущей точки трека, в том
+// числе через границу сегментов, у первой точки трека оно равно нулю.
+package track
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Point - точка трека
+type Point struct {
+	Lat    float64   // широта в градусах
+	Lon    float64   // долгота в градусах
+	Time   time.Time // время UTC
+	Dist   float64   // расстояние от предыдущей точки в метрах
+	Ele    float64   // высота в метрах, если HasEle
+	HasEle bool      // высота известна
+	Ext    string    // содержимое элемента extensions точки GPX-файла как есть
+}
+
+// Segment - непрерывный участок трека
+type Segment struct {
+	Points []Point
+}
+
+// Track - трек поездки
+type Track struct {
+	Name     string    // название трека
+	Segments []Segment // сегменты трека, пустых сегментов нет
+	Total    int       // количество точек во входных данных до фильтрации
+	// HiddenStart и HiddenEnd - скрытые при обработке метры в начале и в конце трека
+	HiddenStart float64
+	HiddenEnd   float64
+	// Laps - время начала кругов после первого: из кругов TCX-файла или отметок кругов
+	// GPX-файла, по возрастанию
+	Laps []time.Time
+	// Namespaces - пространства имен XML по префиксам из корневого элемента GPX-файла,
+	// нужны для записи расширений точек Point.Ext
+	Namespaces map[string]string
+}
+
+// Len возвращает количество точек трека
+func (t *Track) Len() int {
+	var n int
+	for _, s := range t.Segments {
+		n += len(s.Points)
+	}
+	return n
+}
+
+// Points возвращает все точки трека. Если сегмент один, возвращаются его точки без копирования
+func (t *Track) Points() []Point {
+	if len(t.Segments) == 1 {
+		return t.Segments[0].Points
+	}
+	points := make([]Point, 0, t.Len())
+	for _, s := range t.Segments {
+		points = append(points, s.Points...)
+	}
+	return points
+}
+
+// Start возвращает время первой точки трека
+func (t *Track) Start() time.Time {
+	for _, s := range t.Segments {
+		if len(s.Points) > 0 {
+			return s.Points[0].Time
+		}
+	}
+	return time.Time{}
+}
+
+// End возвращает время последней точки трека
+func (t *Track) End() time.Time {
+	for i := len(t.Segments) - 1; i >= 0; i-- {
+		if points := t.Segments[i].Points; len(points) > 0 {
+			return points[len(points)-1].Time
+		}
+	}
+	return time.Time{}
+}
+
+// Key возвращает ключ трека в json-данных поездок - время первой точки в формате unix
+func (t *Track) Key() string {
+	return strconv.FormatInt(t.Start().Unix(), 10)
+}
+
+// FromPoints возвращает трек из одного сегмента с точками points
+func FromPoints(points []Point) *Track {
+	t := &Track{Total: len(points)}
+	if len(points) > 0 {
+		t.Segments = []Segment{{Points: points}}
+	}
+	return t
+}
+
+// hrPattern - элемент пульса в расширениях точки, например <gpxtpx:hr>142</gpxtpx:hr>
+var hrPattern = regexp.MustCompile(`<(?:[\w-]+:)?hr>\s*(\d+)\s*</`)
+
+// HeartRate возвращает пульс в ударах в минуту из расширений точки, если он там есть
+func (p Point) HeartRate() (int, bool) {
+	m := hrPattern.FindStringSubmatch(p.Ext)
+	if m == nil {
+		return 0, false
+	}
+	hr, err := strconv.Atoi(m[1])
+	return hr, err == nil && hr > 0
+}
+
+// powerPattern - элемент мощности в расширениях точки: <power>, <pwr:PowerInWatts> или Watts TCX-файла
+var powerPattern = regexp.MustCompile(`<(?:[\w-]+:)?(?:power|PowerInWatts|Watts)>\s*(\d+)\s*</`)
+
+// Power возвращает мощность в ваттах из расширений точки, если она там есть
+func (p Point) Power() (int, bool) {
+	m := powerPattern.FindStringSubmatch(p.Ext)
+	if m == nil {
+		return 0, false
+	}
+	pw, err := strconv.Atoi(m[1])
+	return pw, err == nil
+}
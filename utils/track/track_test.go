@@ -0,0 +1,61 @@
+package track
+
+import (
+	"strings"
+	"testing"
+)
+
+const xmlSegments = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test">
+	<metadata><name>метаданные</name></metadata>
+	<trk>
+		<name>Утро</name>
+		<trkseg>
+			<trkpt lat="59.907581" lon="30.256245"><time>2021-06-03T14:00:59Z</time></trkpt>
+			<trkpt lat="59.90762" lon="30.256319"><time>2021-06-03T14:01:01Z</time></trkpt>
+		</trkseg>
+		<trkseg>
+			<trkpt lat="59.907591" lon="30.256423"><time>2021-06-03T14:01:05Z</time></trkpt>
+		</trkseg>
+		<trkseg>
+		</trkseg>
+	</trk>
+</gpx>
+`
+
+func TestDecodeSegments(t *testing.T) {
+	trk, err := Decode(strings.NewReader(xmlSegments), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Name != "Утро" {
+		t.Errorf("неверное название %q", trk.Name)
+	}
+	if len(trk.Segments) != 2 || trk.Len() != 3 || trk.Total != 3 {
+		t.Fatalf("неверные сегменты %v", trk.Segments)
+	}
+	points := trk.Points()
+	if len(points) != 3 || points[2] != trk.Segments[1].Points[0] {
+		t.Errorf("неверные точки %v", points)
+	}
+	if points[2].Dist != PointDistance(points[1], points[2]) {
+		t.Errorf("расстояние через границу сегментов %f", points[2].Dist)
+	}
+	if trk.Key() != "1622728859" {
+		t.Errorf("неверный ключ %s", trk.Key())
+	}
+}
+
+func TestHeartRate(t *testing.T) {
+	for ext, want := range map[string]int{
+		"<gpxtpx:TrackPointExtension><gpxtpx:hr>142</gpxtpx:hr></gpxtpx:TrackPointExtension>": 142,
+		"<hr> 97 </hr>":               97,
+		"<gpxtpx:cad>80</gpxtpx:cad>": 0,
+		"":                            0,
+	} {
+		hr, ok := Point{Ext: ext}.HeartRate()
+		if hr != want || ok != (want > 0) {
+			t.Errorf("%q: пульс %d, %v вместо %d", ext, hr, ok, want)
+		}
+	}
+}
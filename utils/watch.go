@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileState - размер и время изменения файла при очередном опросе каталога
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// defaultArchiveName - каталог архива обработанных файлов по умолчанию в базовом каталоге
+// первого входа
+const defaultArchiveName = "gpx-archive"
+
+// watcher следит за появлением новых GPX-файлов по входам настроек
+type watcher struct {
+	archive  string        // каталог, куда переносятся обработанные файлы, пустой - файлы остаются на месте
+	interval time.Duration // интервал опроса входных каталогов
+	cfg      *config       // настройки конвертации: входы, отбор файлов и выходной каталог
+
+	pending map[string]fileState // файлы, запись которых, возможно, еще не закончена
+	done    map[string]fileState // обработанные файлы, оставшиеся во входном каталоге
+}
+
+func newWatcher(archive string, interval time.Duration, cfg *config) *watcher {
+	return &watcher{
+		archive:  archive,
+		interval: interval,
+		cfg:      cfg,
+		pending:  make(map[string]fileState),
+		done:     make(map[string]fileState),
+	}
+}
+
+// inputBase возвращает каталог входа input без файловых масок
+func inputBase(input string) string {
+	if fi, err := os.Stat(input); err == nil && fi.IsDir() {
+		return input
+	}
+	p := filepath.ToSlash(input)
+	if i := strings.IndexAny(p, "*?["); i >= 0 {
+		if j := strings.LastIndex(p[:i], "/"); j > 0 {
+			return filepath.FromSlash(p[:j])
+		} else if j == 0 {
+			return "/"
+		}
+		return "."
+	}
+	return filepath.Dir(input)
+}
+
+func parseWatchArgs(args []string) (*watcher, error) {
+	cfg, err := loadConfigArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	flags := newFlagSet("watch", "Конвертирует новые GPX-файлы входов, как только их запись закончена, и переносит их в архив")
+	var archive string
+	var interval time.Duration
+	addConfigFlags(flags, cfg, true)
+	inputFlags(flags, cfg)
+	flags.StringVar(&cfg.Output, "o", cfg.Output, "Имя каталога, куда будут сохраняться выходные JSON-файлы")
+	htmlFlag(flags, cfg, "Путь html-файла, в который надо вписать ссылки на json-данные поездок")
+	manifestFlag(flags, cfg)
+	flags.StringVar(&archive, "a", "", "Каталог, куда переносятся обработанные GPX-файлы, по умолчанию "+
+		defaultArchiveName+" в каталоге первого входа; -a= оставляет файлы на месте до перезапуска")
+	flags.DurationVar(&interval, "t", 2*time.Second, "Интервал опроса входных каталогов")
+	archiveSet := false
+	err = parseFlags(flags, args, func() error {
+		if len(cfg.Input) < 1 {
+			return errors.New("не указан входной файл")
+		}
+		if interval <= 0 {
+			return fmt.Errorf("неверный интервал опроса %s", interval)
+		}
+		flags.Visit(func(f *flag.Flag) { archiveSet = archiveSet || f.Name == "a" })
+		if !archiveSet {
+			archive = filepath.Join(inputBase(cfg.Input[0]), defaultArchiveName)
+		}
+		if err := checkDir(cfg.Output, "выходной"); err != nil {
+			return err
+		}
+		if err := checkConfig(cfg); err != nil {
+			return err
+		}
+		if archive != "" {
+			return os.MkdirAll(archive, 0755)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newWatcher(archive, interval, cfg), nil
+}
+
+// checkDir проверяет, что dir является существующим каталогом
+func checkDir(dir string, title string) error {
+	fi, err := os.Stat(dir)
+	if (err != nil && os.IsNotExist(err)) || (err == nil && !fi.IsDir()) {
+		return fmt.Errorf("%s каталог '%s' не является каталогом", title, dir)
+	}
+	return err
+}
+
+// archived проверяет, что файл file находится в каталоге архива
+func (w *watcher) archived(file string) bool {
+	if w.archive == "" {
+		return false
+	}
+	rel, err := filepath.Rel(w.archive, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// poll однократно просматривает входы и конвертирует файлы, размер и время изменения
+// которых не изменились с прошлого опроса. Обработанные файлы переносятся в архив
+func (w *watcher) poll() (outputs []string, err error) {
+	files, err := expandInputs(w.cfg.Input, w.cfg.Include, w.cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool)
+	for _, file := range files {
+		if w.archived(file) {
+			continue
+		}
+		fi, err := os.Stat(file)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		present[file] = true
+		state := fileState{fi.Size(), fi.ModTime()}
+		if done, ok := w.done[file]; ok && done == state {
+			continue
+		}
+		if prev, ok := w.pending[file]; !ok || prev != state {
+			w.pending[file] = state // файл новый или еще пишется - ждем следующего опроса
+			continue
+		}
+		delete(w.pending, file)
+		paths, err := convertFile(file, w.cfg)
+		if err != nil { // испорченный файл не должен останавливать наблюдение
+			fmt.Fprintf(os.Stderr, "%s: Ошибка: %s\n", file, err.Error())
+			w.done[file] = state
+			continue
+		}
+		fmt.Println(file + " -> " + strings.Join(paths, ", "))
+		outputs = append(outputs, paths...)
+		if w.archive == "" {
+			w.done[file] = state
+		} else if err = moveFile(file, freePath(filepath.Join(w.archive, filepath.Base(file)))); err != nil {
+			// json-данные уже записаны, поэтому html-файлы все равно обновляются
+			fmt.Fprintf(os.Stderr, "%s: Ошибка: %s\n", file, err.Error())
+			w.done[file] = state
+		}
+	}
+	for file := range w.pending {
+		if !present[file] {
+			delete(w.pending, file)
+		}
+	}
+	for file := range w.done {
+		if !present[file] {
+			delete(w.done, file)
+		}
+	}
+	if len(outputs) > 0 {
+		err = updateHtmls(w.cfg)
+	}
+	return outputs, err
+}
+
+// run опрашивает входы, пока не возникнет ошибка
+func (w *watcher) run() error {
+	fmt.Printf("Ожидание GPX-файлов по входам %s\n", strings.Join(w.cfg.Input, ", "))
+	for {
+		if _, err := w.poll(); err != nil {
+			return err
+		}
+		time.Sleep(w.interval)
+	}
+}
+
+// freePath возвращает путь file, если такого файла нет, или путь с первым свободным
+// номером перед расширением: ride-1.gpx, ride-2.gpx
+func freePath(file string) string {
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(file); os.IsNotExist(err) {
+			return file
+		}
+		file = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// moveFile переносит файл src в dst, копируя его, если переименование невозможно.
+// Существующий файл dst не перезаписывается
+func moveFile(src string, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("файл '%s' уже существует", dst)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	r.Close()
+	return os.Remove(src)
+}
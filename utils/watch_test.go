@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testGpx возвращает содержимое тестового GPX-файла поездки 1622728859
+func testGpx(t *testing.T) []byte {
+	files, _ := filepath.Glob(".test/3_*.gpx")
+	if len(files) != 1 {
+		t.Fatal("нет тестового GPX-файла")
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func Test_watcherPoll(t *testing.T) {
+	data := testGpx(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in")
+	dest := filepath.Join(dir, "routes")
+	archive := filepath.Join(dir, "archive")
+	for _, d := range []string{input, dest, archive} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gpx := filepath.Join(input, "ride.gpx")
+	if err := os.WriteFile(gpx, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// файл с тем же именем в архиве не перезаписывается
+	if err := os.WriteFile(filepath.Join(archive, "ride.gpx"), []byte("прежний"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	cfg.Input = []string{filepath.Join(input, "*.gpx")}
+	cfg.Output = dest
+	w := newWatcher(archive, time.Second, cfg)
+	// первый опрос только запоминает размер файла
+	if outputs, err := w.poll(); err != nil || len(outputs) != 0 {
+		t.Fatalf("первый опрос: %v %v", outputs, err)
+	}
+	// размер не изменился - файл записан полностью
+	outputs, err := w.poll()
+	if err != nil || len(outputs) != 1 {
+		t.Fatalf("второй опрос: %v %v", outputs, err)
+	}
+	if outputs[0] != filepath.Join(dest, "1622728859.js") {
+		t.Errorf("неверный выходной файл %s", outputs[0])
+	}
+	if _, err := os.Stat(filepath.Join(archive, "ride-1.gpx")); err != nil {
+		t.Errorf("файл не перенесен в архив: %v", err)
+	}
+	if prev, _ := os.ReadFile(filepath.Join(archive, "ride.gpx")); string(prev) != "прежний" {
+		t.Error("перезаписан файл архива с тем же именем")
+	}
+	// обработанный файл не должен обрабатываться повторно
+	if outputs, err := w.poll(); err != nil || len(outputs) != 0 {
+		t.Fatalf("третий опрос: %v %v", outputs, err)
+	}
+}
+
+func Test_watcherPollWithoutArchive(t *testing.T) {
+	data := testGpx(t)
+	dir := t.TempDir()
+	gpx := filepath.Join(dir, "ride.gpx")
+	if err := os.WriteFile(gpx, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	cfg.Input = []string{filepath.Join(dir, "*.gpx")}
+	cfg.Output = dir
+	w := newWatcher("", time.Second, cfg)
+	w.poll()
+	// файл дописан между опросами - ждем, пока размер не перестанет меняться
+	if err := os.WriteFile(gpx, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if outputs, _ := w.poll(); len(outputs) != 0 {
+		t.Fatalf("файл сконвертирован до окончания записи: %v", outputs)
+	}
+	if outputs, _ := w.poll(); len(outputs) != 1 {
+		t.Fatalf("файл не сконвертирован: %v", outputs)
+	}
+	if outputs, _ := w.poll(); len(outputs) != 0 {
+		t.Fatalf("файл сконвертирован повторно: %v", outputs)
+	}
+}
+
+func Test_watcherInputs(t *testing.T) {
+	data := testGpx(t)
+	dir := t.TempDir()
+	for _, file := range []string{"2022/ride.gpx", "skip/ride.gpx"} {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := newConfig()
+	cfg.Input = []string{filepath.Join(dir, "**", "*.gpx")}
+	cfg.Exclude = []string{"skip"}
+	cfg.Output = t.TempDir()
+	// архив по умолчанию - в каталоге входа без масок, файлы архива не обрабатываются снова
+	archive := filepath.Join(inputBase(cfg.Input[0]), defaultArchiveName)
+	if archive != filepath.Join(dir, defaultArchiveName) {
+		t.Errorf("каталог архива %s", archive)
+	}
+	if err := os.Mkdir(archive, 0755); err != nil {
+		t.Fatal(err)
+	}
+	w := newWatcher(archive, time.Second, cfg)
+	w.poll()
+	if outputs, err := w.poll(); err != nil || len(outputs) != 1 {
+		t.Fatalf("файлы по маске ** сконвертированы: %v %v", outputs, err)
+	}
+	if _, err := os.Stat(filepath.Join(archive, "ride.gpx")); err != nil {
+		t.Errorf("файл не перенесен в архив: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "skip", "ride.gpx")); err != nil {
+		t.Errorf("исключенный файл обработан: %v", err)
+	}
+	w.poll()
+	if outputs, _ := w.poll(); len(outputs) != 0 {
+		t.Fatalf("файл архива сконвертирован повторно: %v", outputs)
+	}
+}